@@ -0,0 +1,102 @@
+package main
+
+import (
+   "crypto/subtle"
+   "log"
+   "net/http"
+   "strings"
+)
+
+type recorder struct {
+   http.ResponseWriter
+   status int
+   bytes  int64
+}
+
+func (r *recorder) WriteHeader(status int) {
+   if r.status == 0 {
+      r.status = status
+   }
+   r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(data []byte) (int, error) {
+   if r.status == 0 {
+      r.status = http.StatusOK
+   }
+   n, err := r.ResponseWriter.Write(data)
+   r.bytes += int64(n)
+   return n, err
+}
+
+// for http.ResponseController, so Flush still works
+func (r *recorder) Unwrap() http.ResponseWriter {
+   return r.ResponseWriter
+}
+
+func access_log(next http.Handler) http.Handler {
+   return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+      rec := &recorder{ResponseWriter: w}
+      next.ServeHTTP(rec, r)
+      if rec.status == 0 {
+         rec.status = http.StatusOK
+      }
+      log.Print(
+         r.RemoteAddr, " ", r.Method, " ", r.URL.Path, " ",
+         rec.status, " ", rec.bytes,
+      )
+   })
+}
+
+func equal(a, b string) bool {
+   return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// user:pass
+func basic_auth(next http.Handler, auth string) http.Handler {
+   user, pass, _ := strings.Cut(auth, ":")
+   return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+      user2, pass2, ok := r.BasicAuth()
+      if !ok || !equal(user, user2) || !equal(pass, pass2) {
+         w.Header().Set("WWW-Authenticate", `Basic realm="file-serve"`)
+         http.Error(w, "unauthorized", http.StatusUnauthorized)
+         return
+      }
+      next.ServeHTTP(w, r)
+   })
+}
+
+const token_cookie = "file-serve"
+
+// the token is in the printed link. the first visit swaps it for a cookie and
+// redirects, so it does not stay in the address bar or history
+func token_auth(next http.Handler, token string) http.Handler {
+   return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+      query := r.URL.Query()
+      if query.Has("token") {
+         if !equal(query.Get("token"), token) {
+            http.Error(w, "unauthorized", http.StatusUnauthorized)
+            return
+         }
+         http.SetCookie(w, &http.Cookie{
+            Name:     token_cookie,
+            Value:    token,
+            Path:     "/",
+            HttpOnly: true,
+            Secure:   r.TLS != nil,
+            SameSite: http.SameSiteStrictMode,
+         })
+         query.Del("token")
+         location := *r.URL
+         location.RawQuery = query.Encode()
+         http.Redirect(w, r, location.RequestURI(), http.StatusSeeOther)
+         return
+      }
+      cookie, err := r.Cookie(token_cookie)
+      if err != nil || !equal(cookie.Value, token) {
+         http.Error(w, "unauthorized", http.StatusUnauthorized)
+         return
+      }
+      next.ServeHTTP(w, r)
+   })
+}
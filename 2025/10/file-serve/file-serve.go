@@ -1,19 +1,242 @@
 package main
 
 import (
+   "context"
+   "crypto/rand"
+   "errors"
    "flag"
    "fmt"
+   "log"
+   "net"
    "net/http"
+   "os"
+   "os/signal"
+   "path"
+   "strings"
+   "time"
 )
 
+type server struct {
+   files    http.Handler
+   root     *os.Root
+   write    bool
+   markdown bool
+   gallery  bool
+   dir      string   // absolute, for ffmpeg and the thumbnail cache
+   watch    *watcher // nil unless live reload
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+   name := clean(r.URL.Path)
+   query := r.URL.Query()
+   if s.watch != nil && query.Has("reload") {
+      s.watch.events(w, r)
+      return
+   }
+   if r.Method == http.MethodPost {
+      if !s.write {
+         http.Error(w, "read only", http.StatusMethodNotAllowed)
+         return
+      }
+      switch {
+      case query.Has("upload"):
+         s.upload(w, r, name)
+      case query.Has("mkdir"):
+         s.mkdir(w, r, name)
+      case query.Has("delete"):
+         s.delete(w, r, name)
+      default:
+         http.Error(w, "bad request", http.StatusBadRequest)
+      }
+      return
+   }
+   info, err := s.root.Stat(name)
+   if err == nil && info.IsDir() {
+      // relative links need the slash
+      if !strings.HasSuffix(r.URL.Path, "/") {
+         redirect(w, path.Base(r.URL.Path)+"/")
+         return
+      }
+      if s.write && query.Has("zip") {
+         s.zip(w, name)
+         return
+      }
+      if s.markdown && !query.Has("list") {
+         readme := path.Join(name, "readme.md")
+         info, err := s.root.Stat(readme)
+         if err == nil && info.Mode().IsRegular() {
+            s.render(w, readme, true)
+            return
+         }
+      }
+      if s.gallery && !query.Has("list") && s.show_gallery(w, name) {
+         return
+      }
+      if s.write {
+         s.listing(w, name)
+         return
+      }
+      if s.watch != nil {
+         index := path.Join(name, "index.html")
+         info, err := s.root.Stat(index)
+         if err == nil && info.Mode().IsRegular() {
+            s.html_file(w, index)
+            return
+         }
+      }
+   }
+   if s.gallery && err == nil && info.Mode().IsRegular() {
+      if ok, _ := kind(name); ok {
+         switch {
+         case query.Has("thumb"):
+            s.thumb(w, r, name)
+            return
+         case query.Has("play"):
+            s.player(w, name)
+            return
+         }
+      }
+   }
+   if s.markdown && err == nil && info.Mode().IsRegular() {
+      if path.Ext(name) == ".md" {
+         if !query.Has("raw") {
+            s.render(w, name, false)
+            return
+         }
+         // text/markdown is a download in most browsers
+         w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+      }
+   }
+   if s.watch != nil && err == nil && info.Mode().IsRegular() && is_html(name) {
+      s.html_file(w, name)
+      return
+   }
+   s.files.ServeHTTP(w, r)
+}
+
+// for os.Root, which wants "." and not "/"
+func clean(name string) string {
+   name = strings.TrimPrefix(path.Clean("/"+name), "/")
+   if name == "" {
+      return "."
+   }
+   return name
+}
+
+// relative, so it works with -s
+func redirect(w http.ResponseWriter, location string) {
+   w.Header().Set("Location", location)
+   w.WriteHeader(http.StatusSeeOther)
+}
+
 func main() {
+   bind := flag.String("b", "", "bind address, all interfaces if empty")
    port := flag.String("p", ":8080", "port")
    strip := flag.String("s", "", "strip")
+   write := flag.Bool("w", false, "allow upload, delete and mkdir")
+   markdown := flag.Bool("m", false, "render Markdown and readme.md")
+   gallery := flag.Bool("g", false, "gallery for folders with images or video")
+   use_tls := flag.Bool("tls", false, "HTTPS, self-signed unless -cert")
+   cert := flag.String("cert", "", "certificate file")
+   key := flag.String("key", "", "key file")
+   auth := flag.String("auth", "", "basic auth user:pass")
+   token := flag.Bool("t", false, "random token, printed in the link")
+   live := flag.Bool("l", false, "live reload HTML pages on changes")
    flag.Parse()
-   fmt.Printf("localhost%v%v\n", *port, *strip)
-   http.ListenAndServe(
-      *port, http.StripPrefix(
-         *strip, http.FileServer(http.Dir("")),
-      ),
-   )
+   root, err := os.OpenRoot(".")
+   if err != nil {
+      log.Fatal(err)
+   }
+   dir, err := os.Getwd()
+   if err != nil {
+      log.Fatal(err)
+   }
+   srv := &server{
+      files:    http.FileServer(http.Dir("")),
+      root:     root,
+      write:    *write,
+      markdown: *markdown,
+      gallery:  *gallery,
+      dir:      dir,
+   }
+   var handler http.Handler = srv
+   if *write {
+      handler = http.NewCrossOriginProtection().Handler(handler)
+   }
+   handler = http.StripPrefix(*strip, handler)
+   var query string
+   switch {
+   case *auth != "":
+      handler = basic_auth(handler, *auth)
+   case *token:
+      secret := rand.Text()
+      handler = token_auth(handler, secret)
+      query = "?token=" + secret
+   }
+   hs := &http.Server{Addr: *bind + *port, Handler: access_log(handler)}
+   if *live {
+      srv.watch = new_watcher()
+      go srv.watch.poll(root.FS(), time.Second)
+      hs.RegisterOnShutdown(srv.watch.close)
+   }
+   scheme := "http"
+   if *use_tls || *cert != "" {
+      scheme = "https"
+      hs.TLSConfig, err = tls_config(*cert, *key)
+      if err != nil {
+         log.Fatal(err)
+      }
+   }
+   // listen first, so a busy port fails before the links are printed
+   listener, err := net.Listen("tcp", hs.Addr)
+   if err != nil {
+      log.Fatal(err)
+   }
+   location := strings.TrimSuffix(*strip, "/") + "/" + query
+   for _, host := range hosts(*bind) {
+      fmt.Printf("%v://%v%v%v\n", scheme, host, *port, location)
+   }
+   stopped := make(chan struct{})
+   go shutdown(hs, stopped)
+   if scheme == "https" {
+      err = hs.ServeTLS(listener, "", "")
+   } else {
+      err = hs.Serve(listener)
+   }
+   if !errors.Is(err, http.ErrServerClosed) {
+      log.Fatal(err)
+   }
+   <-stopped
+}
+
+// Serve returns as soon as Shutdown starts, so main waits on stopped for the
+// requests in flight. a second interrupt kills the process
+func shutdown(hs *http.Server, stopped chan struct{}) {
+   ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+   <-ctx.Done()
+   stop()
+   log.Print("shutting down")
+   ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+   defer cancel()
+   err := hs.Shutdown(ctx)
+   if err != nil {
+      log.Print(err)
+   }
+   close(stopped)
+}
+
+// where the server can be reached, not just localhost
+func hosts(bind string) []string {
+   if bind != "" {
+      return []string{bind}
+   }
+   var hosts []string
+   for _, ip := range addresses() {
+      if ip.To4() == nil {
+         hosts = append(hosts, "["+ip.String()+"]")
+      } else {
+         hosts = append(hosts, ip.String())
+      }
+   }
+   return hosts
 }
@@ -0,0 +1,110 @@
+package main
+
+import (
+   "bytes"
+   _ "embed"
+   "html/template"
+   "io/fs"
+   "net/http"
+   "net/url"
+   "path"
+   "slices"
+   "strings"
+)
+
+var images = []string{".gif", ".jpeg", ".jpg", ".png"}
+
+var videos = []string{".m4v", ".mkv", ".mov", ".mp4", ".webm"}
+
+// media, and whether it is video
+func kind(name string) (bool, bool) {
+   ext := strings.ToLower(path.Ext(name))
+   if slices.Contains(videos, ext) {
+      return true, true
+   }
+   return slices.Contains(images, ext), false
+}
+
+//go:embed gallery.html
+var gallery_html string
+
+var gallery_template = template.Must(template.New("").Parse(gallery_html))
+
+type anchor struct {
+   Name string
+   Href string
+}
+
+// ReadDir is sorted by name, so previous and next follow the gallery
+func (s *server) media(dir string) ([]anchor, []anchor, error) {
+   entries, err := fs.ReadDir(s.root.FS(), dir)
+   if err != nil {
+      return nil, nil, err
+   }
+   var dirs, items []anchor
+   for _, entry := range entries {
+      href := (&url.URL{Path: entry.Name()}).String()
+      if entry.IsDir() {
+         dirs = append(dirs, anchor{entry.Name(), href + "/"})
+      } else if ok, _ := kind(entry.Name()); ok {
+         items = append(items, anchor{entry.Name(), href})
+      }
+   }
+   return dirs, items, nil
+}
+
+// false if there is nothing to show, so the folder gets the usual listing
+func (s *server) show_gallery(w http.ResponseWriter, dir string) bool {
+   dirs, items, err := s.media(dir)
+   if err != nil || len(items) == 0 {
+      return false
+   }
+   var page bytes.Buffer
+   err = gallery_template.ExecuteTemplate(&page, "gallery", struct {
+      Title string
+      Dirs  []anchor
+      Items []anchor
+   }{"/" + strings.TrimPrefix(dir, "."), dirs, items})
+   if err != nil {
+      http.Error(w, err.Error(), http.StatusInternalServerError)
+      return true
+   }
+   s.write_html(w, page.Bytes())
+   return true
+}
+
+func (s *server) player(w http.ResponseWriter, name string) {
+   _, items, err := s.media(path.Dir(name))
+   if err != nil {
+      http.Error(w, err.Error(), http.StatusInternalServerError)
+      return
+   }
+   var previous, next string
+   for i, item := range items {
+      if item.Name == path.Base(name) {
+         if i > 0 {
+            previous = items[i-1].Href
+         }
+         if i < len(items)-1 {
+            next = items[i+1].Href
+         }
+      }
+   }
+   _, video := kind(name)
+   var page bytes.Buffer
+   err = gallery_template.ExecuteTemplate(&page, "player", struct {
+      Title    string
+      Href     string
+      Video    bool
+      Previous string
+      Next     string
+   }{
+      path.Base(name), (&url.URL{Path: path.Base(name)}).String(), video,
+      previous, next,
+   })
+   if err != nil {
+      http.Error(w, err.Error(), http.StatusInternalServerError)
+      return
+   }
+   s.write_html(w, page.Bytes())
+}
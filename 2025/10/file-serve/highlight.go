@@ -0,0 +1,144 @@
+package main
+
+import (
+   "go/scanner"
+   "go/token"
+   "html"
+   "strings"
+)
+
+// classes are k keyword, s string, n number, c comment, a added, d deleted
+func highlight(lang, code string) string {
+   switch lang {
+   case "go":
+      return highlight_go(code)
+   case "diff":
+      return highlight_diff(code)
+   }
+   return highlight_generic(code)
+}
+
+func span(class, text string) string {
+   return `<span class="` + class + `">` + html.EscapeString(text) + "</span>"
+}
+
+// go/scanner, so raw strings and runes are right. snippets that do not
+// parse still scan
+func highlight_go(code string) string {
+   src := []byte(code)
+   file := token.NewFileSet().AddFile("", -1, len(src))
+   var s scanner.Scanner
+   s.Init(file, src, nil, scanner.ScanComments)
+   var b strings.Builder
+   last := 0
+   for {
+      pos, tok, lit := s.Scan()
+      if tok == token.EOF {
+         break
+      }
+      var class string
+      switch {
+      case tok.IsKeyword():
+         class = "k"
+      case tok == token.STRING || tok == token.CHAR:
+         class = "s"
+      case tok == token.INT || tok == token.FLOAT || tok == token.IMAG:
+         class = "n"
+      case tok == token.COMMENT:
+         class = "c"
+      default:
+         continue
+      }
+      start := file.Offset(pos)
+      end := min(start+len(lit), len(code))
+      if start < last {
+         continue
+      }
+      b.WriteString(html.EscapeString(code[last:start]))
+      b.WriteString(span(class, code[start:end]))
+      last = end
+   }
+   b.WriteString(html.EscapeString(code[last:]))
+   return b.String()
+}
+
+func highlight_diff(code string) string {
+   var b strings.Builder
+   for i, line := range strings.Split(code, "\n") {
+      if i > 0 {
+         b.WriteByte('\n')
+      }
+      switch {
+      case strings.HasPrefix(line, "@@"):
+         b.WriteString(span("c", line))
+      case strings.HasPrefix(line, "+"):
+         b.WriteString(span("a", line))
+      case strings.HasPrefix(line, "-"):
+         b.WriteString(span("d", line))
+      default:
+         b.WriteString(html.EscapeString(line))
+      }
+   }
+   return b.String()
+}
+
+// strings, numbers and the usual comment styles, which covers the JSON, shell,
+// TOML and XML in the journal well enough
+func highlight_generic(code string) string {
+   var b strings.Builder
+   last := 0
+   emit := func(class string, start, end int) {
+      b.WriteString(html.EscapeString(code[last:start]))
+      b.WriteString(span(class, code[start:end]))
+      last = end
+   }
+   for i := 0; i < len(code); {
+      rest := code[i:]
+      c := code[i]
+      switch {
+      case c == '"' || c == '\'' || c == '`':
+         end := i + 1
+         for end < len(code) && code[end] != c && code[end] != '\n' {
+            if code[end] == '\\' {
+               end++
+            }
+            end++
+         }
+         end = min(end+1, len(code))
+         emit("s", i, end)
+         i = end
+      case strings.HasPrefix(rest, "//") && (i == 0 || code[i-1] != ':'),
+         c == '#' && (i == 0 || code[i-1] == ' ' || code[i-1] == '\n'):
+         end := strings.IndexByte(rest, '\n')
+         if end < 0 {
+            end = len(rest)
+         }
+         emit("c", i, i+end)
+         i += end
+      case strings.HasPrefix(rest, "/*"), strings.HasPrefix(rest, "<!--"):
+         close := "*/"
+         if c == '<' {
+            close = "-->"
+         }
+         end := strings.Index(rest, close)
+         if end < 0 {
+            end = len(rest)
+         } else {
+            end += len(close)
+         }
+         emit("c", i, i+end)
+         i += end
+      case c >= '0' && c <= '9' && (i == 0 || !word(code[i-1])):
+         end := i
+         for end < len(code) && (word(code[end]) || code[end] == '.') {
+            end++
+         }
+         emit("n", i, end)
+         i = end
+      default:
+         i++
+      }
+   }
+   b.WriteString(html.EscapeString(code[last:]))
+   return b.String()
+}
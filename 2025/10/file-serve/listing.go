@@ -0,0 +1,265 @@
+package main
+
+import (
+   "archive/zip"
+   "bytes"
+   "crypto/rand"
+   "html/template"
+   "io"
+   "io/fs"
+   "log"
+   "net/http"
+   "net/url"
+   "os"
+   "path"
+   "slices"
+   "strings"
+   "time"
+)
+
+type entry struct {
+   Name string
+   Href string
+   Dir  bool
+   Size int64
+   Time string
+}
+
+func (s *server) listing(w http.ResponseWriter, name string) {
+   dir, err := fs.ReadDir(s.root.FS(), name)
+   if err != nil {
+      http.Error(w, err.Error(), http.StatusInternalServerError)
+      return
+   }
+   var entries []entry
+   for _, item := range dir {
+      info, err := item.Info()
+      if err != nil {
+         continue
+      }
+      e := entry{
+         Name: item.Name(),
+         Href: (&url.URL{Path: item.Name()}).String(),
+         Dir:  item.IsDir(),
+         Time: info.ModTime().Format(time.DateTime),
+      }
+      if e.Dir {
+         e.Href += "/"
+      } else {
+         e.Size = info.Size()
+      }
+      entries = append(entries, e)
+   }
+   // folders first
+   slices.SortStableFunc(entries, func(a, b entry) int {
+      if a.Dir != b.Dir {
+         if a.Dir {
+            return -1
+         }
+         return 1
+      }
+      return strings.Compare(a.Name, b.Name)
+   })
+   var page bytes.Buffer
+   err = listing_template.Execute(&page, struct {
+      Name    string
+      Entries []entry
+   }{"/" + strings.TrimPrefix(name, "."), entries})
+   if err != nil {
+      http.Error(w, err.Error(), http.StatusInternalServerError)
+      return
+   }
+   s.write_html(w, page.Bytes())
+}
+
+var listing_template = template.Must(template.New("").Parse(`<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width">
+<title>{{ .Name }}</title>
+<style>
+body { font-family: sans-serif }
+td { padding: 0 1em 0 0 }
+form { display: inline }
+</style>
+</head>
+<body>
+<h1>{{ .Name }}</h1>
+<form method="post" action="?upload" enctype="multipart/form-data">
+<input type="file" name="file" multiple required>
+<button>upload</button>
+</form>
+<form method="post" action="?mkdir">
+<input name="name" placeholder="folder" required>
+<button>mkdir</button>
+</form>
+<p><a href="?zip">download folder as zip</a></p>
+<table>
+<tr><td><a href="../">../</a></td></tr>
+{{- range .Entries }}
+<tr>
+<td><a href="{{ .Href }}">{{ .Name }}{{ if .Dir }}/{{ end }}</a></td>
+<td>{{ if not .Dir }}{{ .Size }}{{ end }}</td>
+<td>{{ .Time }}</td>
+<td>
+<form method="post" action="?delete" onsubmit="return confirm('delete?')">
+<input type="hidden" name="name" value="{{ .Name }}">
+<button>delete</button>
+</form>
+</td>
+</tr>
+{{- end }}
+</table>
+</body>
+</html>
+`))
+
+// a single name inside dir, so a form cannot reach anywhere else
+func child(dir, name string) (string, bool) {
+   if name == "" || name == "." || name == ".." {
+      return "", false
+   }
+   if strings.ContainsAny(name, `/\`) {
+      return "", false
+   }
+   return path.Join(dir, name), true
+}
+
+// parts are streamed to a temporary file, then renamed, so a broken upload
+// does not leave half a file
+func (s *server) upload(w http.ResponseWriter, r *http.Request, dir string) {
+   reader, err := r.MultipartReader()
+   if err != nil {
+      http.Error(w, err.Error(), http.StatusBadRequest)
+      return
+   }
+   for {
+      part, err := reader.NextPart()
+      if err == io.EOF {
+         break
+      }
+      if err != nil {
+         http.Error(w, err.Error(), http.StatusBadRequest)
+         return
+      }
+      if part.FileName() == "" {
+         continue
+      }
+      name, ok := child(dir, path.Base(part.FileName()))
+      if !ok {
+         http.Error(w, "bad file name", http.StatusBadRequest)
+         return
+      }
+      err = s.save(name, part)
+      if err != nil {
+         http.Error(w, err.Error(), http.StatusInternalServerError)
+         return
+      }
+      log.Print("upload ", name)
+   }
+   redirect(w, "./")
+}
+
+func (s *server) save(name string, data io.Reader) error {
+   temp := path.Join(path.Dir(name), ".upload-"+rand.Text())
+   file, err := s.root.OpenFile(temp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+   if err != nil {
+      return err
+   }
+   _, err = io.Copy(file, data)
+   if err2 := file.Close(); err == nil {
+      err = err2
+   }
+   if err == nil {
+      err = s.root.Rename(temp, name)
+   }
+   if err != nil {
+      s.root.Remove(temp)
+   }
+   return err
+}
+
+func (s *server) mkdir(w http.ResponseWriter, r *http.Request, dir string) {
+   name, ok := child(dir, r.FormValue("name"))
+   if !ok {
+      http.Error(w, "bad folder name", http.StatusBadRequest)
+      return
+   }
+   err := s.root.Mkdir(name, os.ModePerm)
+   if err != nil {
+      http.Error(w, err.Error(), http.StatusInternalServerError)
+      return
+   }
+   log.Print("mkdir ", name)
+   redirect(w, "./")
+}
+
+// files and empty folders only
+func (s *server) delete(w http.ResponseWriter, r *http.Request, dir string) {
+   name, ok := child(dir, r.FormValue("name"))
+   if !ok {
+      http.Error(w, "bad name", http.StatusBadRequest)
+      return
+   }
+   err := s.root.Remove(name)
+   if err != nil {
+      http.Error(w, err.Error(), http.StatusInternalServerError)
+      return
+   }
+   log.Print("delete ", name)
+   redirect(w, "./")
+}
+
+// streamed, so there is no length and no temporary file
+func (s *server) zip(w http.ResponseWriter, dir string) {
+   base := path.Base(dir)
+   if base == "." {
+      base = "root"
+   }
+   w.Header().Set("Content-Type", "application/zip")
+   w.Header().Set(
+      "Content-Disposition", `attachment; filename="`+base+`.zip"`,
+   )
+   archive := zip.NewWriter(w)
+   files := s.root.FS()
+   err := fs.WalkDir(files, dir, func(name string, item fs.DirEntry, err error) error {
+      if err != nil {
+         return err
+      }
+      if !item.Type().IsRegular() {
+         return nil
+      }
+      info, err := item.Info()
+      if err != nil {
+         return err
+      }
+      head, err := zip.FileInfoHeader(info)
+      if err != nil {
+         return err
+      }
+      head.Name = strings.TrimPrefix(name, dir+"/")
+      if dir == "." {
+         head.Name = name
+      }
+      head.Method = zip.Deflate
+      out, err := archive.CreateHeader(head)
+      if err != nil {
+         return err
+      }
+      file, err := files.Open(name)
+      if err != nil {
+         return err
+      }
+      defer file.Close()
+      _, err = io.Copy(out, file)
+      return err
+   })
+   if err == nil {
+      err = archive.Close()
+   }
+   // too late for a status code
+   if err != nil {
+      log.Print(err)
+   }
+}
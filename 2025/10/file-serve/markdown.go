@@ -0,0 +1,396 @@
+package main
+
+import (
+   "html"
+   "regexp"
+   "strconv"
+   "strings"
+)
+
+// enough Markdown for the journal: headings, paragraphs, fences, lists,
+// quotes, rules, links, images, code and emphasis. no tables or raw HTML
+func markdown(src string) string {
+   src = strings.ReplaceAll(src, "\r\n", "\n")
+   var b strings.Builder
+   blocks(&b, strings.Split(src, "\n"), false)
+   return b.String()
+}
+
+// tight is for list items without blank lines, which get no <p>
+func blocks(b *strings.Builder, lines []string, tight bool) {
+   for i := 0; i < len(lines); {
+      line := lines[i]
+      trim := strings.TrimSpace(line)
+      switch {
+      case trim == "":
+         i++
+      case fence(trim) != "":
+         i = code_block(b, lines, i)
+      case heading(trim) > 0:
+         level := strconv.Itoa(heading(trim))
+         text := strings.TrimSpace(strings.TrimLeft(trim, "#"))
+         b.WriteString("<h" + level + ">" + inline(text) + "</h" + level + ">\n")
+         i++
+      case rule(trim):
+         b.WriteString("<hr>\n")
+         i++
+      case strings.HasPrefix(trim, ">"):
+         var quote []string
+         for ; i < len(lines); i++ {
+            trim := strings.TrimSpace(lines[i])
+            if !strings.HasPrefix(trim, ">") {
+               break
+            }
+            trim = strings.TrimPrefix(trim, ">")
+            quote = append(quote, strings.TrimPrefix(trim, " "))
+         }
+         b.WriteString("<blockquote>\n")
+         blocks(b, quote, false)
+         b.WriteString("</blockquote>\n")
+      case is_item(line):
+         i = list(b, lines, i)
+      default:
+         var text []string
+         for ; i < len(lines); i++ {
+            if len(text) > 0 && starts_block(lines[i]) {
+               break
+            }
+            trim := strings.TrimSpace(lines[i])
+            if trim == "" {
+               break
+            }
+            text = append(text, trim)
+         }
+         if tight {
+            b.WriteString(inline(strings.Join(text, "\n")) + "\n")
+         } else {
+            b.WriteString("<p>" + inline(strings.Join(text, "\n")) + "</p>\n")
+         }
+      }
+   }
+}
+
+// anything that ends a paragraph
+func starts_block(line string) bool {
+   trim := strings.TrimSpace(line)
+   return fence(trim) != "" || heading(trim) > 0 || rule(trim) ||
+      strings.HasPrefix(trim, ">") || is_item(line)
+}
+
+func fence(trim string) string {
+   for _, marker := range []string{"~~~", "```"} {
+      if strings.HasPrefix(trim, marker) {
+         return marker
+      }
+   }
+   return ""
+}
+
+func code_block(b *strings.Builder, lines []string, i int) int {
+   trim := strings.TrimSpace(lines[i])
+   marker := fence(trim)
+   lang := strings.TrimSpace(strings.TrimLeft(trim, marker[:1]))
+   margin := indent(lines[i])
+   var code []string
+   for i++; i < len(lines); i++ {
+      if strings.HasPrefix(strings.TrimSpace(lines[i]), marker) {
+         i++
+         break
+      }
+      code = append(code, dedent(lines[i], margin))
+   }
+   b.WriteString("<pre><code")
+   if lang != "" {
+      b.WriteString(` class="language-` + html.EscapeString(lang) + `"`)
+   }
+   b.WriteString(">")
+   b.WriteString(highlight(lang, strings.Join(code, "\n")))
+   b.WriteString("</code></pre>\n")
+   return i
+}
+
+func heading(trim string) int {
+   level := len(trim) - len(strings.TrimLeft(trim, "#"))
+   if level < 1 || level > 6 {
+      return 0
+   }
+   if len(trim) > level && trim[level] != ' ' {
+      return 0
+   }
+   return level
+}
+
+// ---, *** or ___, spaces allowed
+func rule(trim string) bool {
+   if len(trim) < 3 || strings.Trim(trim, "-*_ ") != "" {
+      return false
+   }
+   compact := strings.ReplaceAll(trim, " ", "")
+   return len(compact) >= 3 && strings.Count(compact, compact[:1]) == len(compact)
+}
+
+type item struct {
+   indent  int
+   content int // column the text starts at
+   ordered bool
+   start   string
+   text    string
+}
+
+var item_pattern = regexp.MustCompile(`^( *)([-*+]|(\d{1,9})[.)])( +|$)(.*)$`)
+
+func parse_item(line string) (item, bool) {
+   match := item_pattern.FindStringSubmatch(line)
+   if match == nil {
+      return item{}, false
+   }
+   return item{
+      indent:  len(match[1]),
+      content: len(match[1]) + len(match[2]) + len(match[4]),
+      ordered: match[3] != "",
+      start:   match[3],
+      text:    match[5],
+   }, true
+}
+
+func is_item(line string) bool {
+   _, ok := parse_item(line)
+   return ok && !rule(strings.TrimSpace(line))
+}
+
+// items are siblings while they are not indented past the first one's text.
+// anything indented further belongs to the item above, nested lists included
+func list(b *strings.Builder, lines []string, i int) int {
+   first, _ := parse_item(lines[i])
+   var items [][]string
+   loose := false
+   for i < len(lines) {
+      line := lines[i]
+      if strings.TrimSpace(line) == "" {
+         j := i
+         for j < len(lines) && strings.TrimSpace(lines[j]) == "" {
+            j++
+         }
+         if j == len(lines) {
+            break
+         }
+         next, ok := parse_item(lines[j])
+         sibling := ok && next.indent < first.content &&
+            next.ordered == first.ordered
+         if !sibling && indent(lines[j]) < first.content {
+            break
+         }
+         loose = true
+         for ; i < j; i++ {
+            items[len(items)-1] = append(items[len(items)-1], "")
+         }
+         continue
+      }
+      it, ok := parse_item(line)
+      switch {
+      case ok && it.indent < first.content && !rule(strings.TrimSpace(line)):
+         if it.ordered != first.ordered {
+            return finish_list(b, first, items, loose, i)
+         }
+         items = append(items, []string{it.text})
+      case indent(line) >= first.content:
+         items[len(items)-1] = append(
+            items[len(items)-1], dedent(line, first.content),
+         )
+      case !starts_block(line):
+         // lazy continuation of the item's paragraph
+         items[len(items)-1] = append(
+            items[len(items)-1], strings.TrimSpace(line),
+         )
+      default:
+         return finish_list(b, first, items, loose, i)
+      }
+      i++
+   }
+   return finish_list(b, first, items, loose, i)
+}
+
+func finish_list(
+   b *strings.Builder, first item, items [][]string, loose bool, i int,
+) int {
+   tag := "ul"
+   if first.ordered {
+      tag = "ol"
+   }
+   b.WriteString("<" + tag)
+   if first.ordered && first.start != "1" {
+      start, _ := strconv.Atoi(first.start)
+      b.WriteString(` start="` + strconv.Itoa(start) + `"`)
+   }
+   b.WriteString(">\n")
+   for _, lines := range items {
+      b.WriteString("<li>")
+      blocks(b, lines, !loose)
+      b.WriteString("</li>\n")
+   }
+   b.WriteString("</" + tag + ">\n")
+   return i
+}
+
+func indent(line string) int {
+   return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+func dedent(line string, n int) string {
+   return line[min(n, indent(line)):]
+}
+
+func inline(text string) string {
+   var b strings.Builder
+   for i := 0; i < len(text); {
+      rest := text[i:]
+      switch {
+      case rest[0] == '\\' && len(rest) > 1 &&
+         strings.IndexByte("\\`*_[]()<>!#+-.", rest[1]) >= 0:
+         b.WriteString(html.EscapeString(rest[1:2]))
+         i += 2
+         continue
+      case rest[0] == '`':
+         ticks := len(rest) - len(strings.TrimLeft(rest, "`"))
+         end := strings.Index(rest[ticks:], rest[:ticks])
+         if end >= 0 {
+            code := strings.TrimSpace(rest[ticks : ticks+end])
+            b.WriteString("<code>" + html.EscapeString(code) + "</code>")
+            i += ticks + end + ticks
+            continue
+         }
+         b.WriteString(rest[:ticks])
+         i += ticks
+         continue
+      case strings.HasPrefix(rest, "!["):
+         if alt, src, n, ok := link(rest[1:]); ok {
+            b.WriteString(
+               `<img src="` + safe_url(src) + `" alt="` +
+                  html.EscapeString(alt) + `">`,
+            )
+            i += 1 + n
+            continue
+         }
+      case rest[0] == '[':
+         if label, href, n, ok := link(rest); ok {
+            b.WriteString(
+               `<a href="` + safe_url(href) + `">` + inline(label) + "</a>",
+            )
+            i += n
+            continue
+         }
+      case rest[0] == '<':
+         end := strings.IndexByte(rest, '>')
+         if end > 0 && is_url(rest[1:end]) {
+            address := rest[1:end]
+            b.WriteString(
+               `<a href="` + safe_url(address) + `">` +
+                  html.EscapeString(address) + "</a>",
+            )
+            i += end + 1
+            continue
+         }
+      case is_url(rest) && (i == 0 || !word(text[i-1])):
+         end := strings.IndexAny(rest, " \t\n")
+         if end < 0 {
+            end = len(rest)
+         }
+         address := strings.TrimRight(rest[:end], ".,;:!?)")
+         b.WriteString(
+            `<a href="` + safe_url(address) + `">` +
+               html.EscapeString(address) + "</a>",
+         )
+         i += len(address)
+         continue
+      case strings.HasPrefix(rest, "**") || strings.HasPrefix(rest, "__"):
+         end := strings.Index(rest[2:], rest[:2])
+         if end > 0 && (rest[0] == '*' || i == 0 || !word(text[i-1])) {
+            b.WriteString("<strong>" + inline(rest[2:2+end]) + "</strong>")
+            i += end + 4
+            continue
+         }
+         b.WriteString(rest[:2])
+         i += 2
+         continue
+      case rest[0] == '*' || rest[0] == '_':
+         end := strings.IndexByte(rest[1:], rest[0])
+         // snake_case is not emphasis
+         open := rest[0] == '*' || i == 0 || !word(text[i-1])
+         if open && end > 0 && rest[1] != ' ' {
+            b.WriteString("<em>" + inline(rest[1:1+end]) + "</em>")
+            i += end + 2
+            continue
+         }
+      }
+      b.WriteString(html.EscapeString(rest[:1]))
+      i++
+   }
+   return b.String()
+}
+
+// [label](href "title"), with brackets and parentheses allowed to nest
+func link(text string) (string, string, int, bool) {
+   close := matching(text, '[', ']')
+   if close < 0 || close+1 >= len(text) || text[close+1] != '(' {
+      return "", "", 0, false
+   }
+   end := matching(text[close+1:], '(', ')')
+   if end < 0 {
+      return "", "", 0, false
+   }
+   href := strings.TrimSpace(text[close+2 : close+1+end])
+   href, _, _ = strings.Cut(href, ` "`)
+   href = strings.Trim(href, "<>")
+   return text[1:close], href, close + 2 + end, true
+}
+
+func matching(text string, open, close byte) int {
+   depth := 0
+   for i := 0; i < len(text); i++ {
+      switch text[i] {
+      case '\\':
+         i++
+      case open:
+         depth++
+      case close:
+         depth--
+         if depth == 0 {
+            return i
+         }
+      }
+   }
+   return -1
+}
+
+func is_url(text string) bool {
+   return strings.HasPrefix(text, "https://") ||
+      strings.HasPrefix(text, "http://")
+}
+
+func word(c byte) bool {
+   return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' ||
+      c >= 'A' && c <= 'Z'
+}
+
+// relative links, web and mail only. no javascript:
+func safe_url(address string) string {
+   scheme, _, ok := strings.Cut(address, ":")
+   if ok && !strings.ContainsAny(scheme, "/?#") {
+      switch strings.ToLower(scheme) {
+      case "http", "https", "mailto":
+      default:
+         return "#"
+      }
+   }
+   return html.EscapeString(address)
+}
+
+// the first # heading, for the page title
+func title(src string) string {
+   for _, line := range strings.Split(src, "\n") {
+      if text, ok := strings.CutPrefix(line, "# "); ok {
+         return strings.TrimSpace(text)
+      }
+   }
+   return ""
+}
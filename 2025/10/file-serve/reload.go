@@ -0,0 +1,155 @@
+package main
+
+import (
+   "bytes"
+   "fmt"
+   "hash/fnv"
+   "io/fs"
+   "log"
+   "net/http"
+   "path"
+   "strings"
+   "sync"
+   "time"
+)
+
+// polling, so no cgo or inotify limits. names starting with . are skipped, or
+// every git command would reload the page
+type watcher struct {
+   mu      sync.Mutex
+   clients map[chan struct{}]bool
+   done    chan struct{}
+}
+
+func new_watcher() *watcher {
+   return &watcher{
+      clients: map[chan struct{}]bool{},
+      done:    make(chan struct{}),
+   }
+}
+
+func (w *watcher) poll(files fs.FS, every time.Duration) {
+   last := snapshot(files)
+   ticker := time.NewTicker(every)
+   defer ticker.Stop()
+   for {
+      select {
+      case <-w.done:
+         return
+      case <-ticker.C:
+      }
+      next := snapshot(files)
+      if next == last {
+         continue
+      }
+      last = next
+      w.mu.Lock()
+      for client := range w.clients {
+         // a client that has not taken the last one will reload anyway
+         select {
+         case client <- struct{}{}:
+         default:
+         }
+      }
+      w.mu.Unlock()
+   }
+}
+
+// a hash of every name, size and time
+func snapshot(files fs.FS) uint64 {
+   sum := fnv.New64a()
+   fs.WalkDir(files, ".", func(name string, entry fs.DirEntry, err error) error {
+      if err != nil {
+         return nil
+      }
+      if name != "." && strings.HasPrefix(entry.Name(), ".") {
+         if entry.IsDir() {
+            return fs.SkipDir
+         }
+         return nil
+      }
+      info, err := entry.Info()
+      if err != nil {
+         return nil
+      }
+      fmt.Fprint(sum, name, info.Size(), info.ModTime().UnixNano(), "\x00")
+      return nil
+   })
+   return sum.Sum64()
+}
+
+// for Server.RegisterOnShutdown. event streams never go idle, so Shutdown
+// would wait on them until its timeout
+func (w *watcher) close() {
+   close(w.done)
+}
+
+func (w *watcher) events(rw http.ResponseWriter, r *http.Request) {
+   client := make(chan struct{}, 1)
+   w.mu.Lock()
+   w.clients[client] = true
+   w.mu.Unlock()
+   defer func() {
+      w.mu.Lock()
+      delete(w.clients, client)
+      w.mu.Unlock()
+   }()
+   rw.Header().Set("Content-Type", "text/event-stream")
+   rw.Header().Set("Cache-Control", "no-cache")
+   control := http.NewResponseController(rw)
+   fmt.Fprint(rw, ": live reload\n\n")
+   err := control.Flush()
+   if err != nil {
+      log.Print(err)
+      return
+   }
+   for {
+      select {
+      case <-r.Context().Done():
+         return
+      case <-w.done:
+         return
+      case <-client:
+         fmt.Fprint(rw, "data: change\n\n")
+         err := control.Flush()
+         if err != nil {
+            return
+         }
+      }
+   }
+}
+
+// relative, so it works with -s from any folder
+const reload_script = `<script>
+new EventSource("?reload").onmessage = () => location.reload()
+</script>
+`
+
+// every HTML page goes through here, generated or not, to get the script
+func (s *server) write_html(w http.ResponseWriter, page []byte) {
+   if s.watch != nil {
+      end := bytes.LastIndex(page, []byte("</body>"))
+      if end < 0 {
+         end = len(page)
+      }
+      page = bytes.Join(
+         [][]byte{page[:end], []byte(reload_script), page[end:]}, nil,
+      )
+   }
+   w.Header().Set("Content-Type", "text/html; charset=utf-8")
+   w.Write(page)
+}
+
+func (s *server) html_file(w http.ResponseWriter, name string) {
+   data, err := s.root.ReadFile(name)
+   if err != nil {
+      http.Error(w, err.Error(), http.StatusInternalServerError)
+      return
+   }
+   s.write_html(w, data)
+}
+
+func is_html(name string) bool {
+   ext := strings.ToLower(path.Ext(name))
+   return ext == ".html" || ext == ".htm"
+}
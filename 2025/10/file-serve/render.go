@@ -0,0 +1,42 @@
+package main
+
+import (
+   "bytes"
+   _ "embed"
+   "html/template"
+   "net/http"
+   "net/url"
+   "path"
+)
+
+//go:embed page.html
+var page string
+
+var page_template = template.Must(template.New("").Parse(page))
+
+// dir is true for a readme.md shown as the folder index
+func (s *server) render(w http.ResponseWriter, name string, dir bool) {
+   data, err := s.root.ReadFile(name)
+   if err != nil {
+      http.Error(w, err.Error(), http.StatusInternalServerError)
+      return
+   }
+   src := string(data)
+   heading := title(src)
+   if heading == "" {
+      heading = path.Base(name)
+   }
+   raw := (&url.URL{Path: path.Base(name), RawQuery: "raw"}).String()
+   var page bytes.Buffer
+   err = page_template.Execute(&page, struct {
+      Title string
+      Raw   string
+      Files bool
+      Body  template.HTML
+   }{heading, raw, dir, template.HTML(markdown(src))})
+   if err != nil {
+      http.Error(w, err.Error(), http.StatusInternalServerError)
+      return
+   }
+   s.write_html(w, page.Bytes())
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+   "bytes"
+   "crypto/sha256"
+   "encoding/hex"
+   "errors"
+   "fmt"
+   "image"
+   "image/color"
+   _ "image/gif"
+   "image/jpeg"
+   _ "image/png"
+   "io/fs"
+   "log"
+   "net/http"
+   "os"
+   "os/exec"
+   "path/filepath"
+   "runtime"
+   "time"
+)
+
+const thumb_size = 320
+
+// decoding and ffmpeg are heavy, and a gallery asks for every thumbnail at once
+var thumb_limit = make(chan struct{}, runtime.NumCPU())
+
+func (s *server) thumb(w http.ResponseWriter, r *http.Request, name string) {
+   info, err := s.root.Stat(name)
+   if err != nil {
+      http.Error(w, err.Error(), http.StatusNotFound)
+      return
+   }
+   cache, err := s.thumbnail(name, info)
+   if err != nil {
+      log.Print(name, ": ", err)
+      http.Error(w, err.Error(), http.StatusInternalServerError)
+      return
+   }
+   file, err := os.Open(cache)
+   if err != nil {
+      http.Error(w, err.Error(), http.StatusInternalServerError)
+      return
+   }
+   defer file.Close()
+   w.Header().Set("Content-Type", "image/jpeg")
+   http.ServeContent(w, r, "", info.ModTime(), file)
+}
+
+// a new mtime or size is a new key, so stale thumbnails are never served.
+// old ones are left for the OS to clean up
+func cache_name(abs string, info fs.FileInfo) (string, error) {
+   dir, err := os.UserCacheDir()
+   if err != nil {
+      return "", err
+   }
+   sum := sha256.Sum256(
+      fmt.Append(nil, abs, info.ModTime().UnixNano(), info.Size()),
+   )
+   return filepath.Join(dir, "file-serve", hex.EncodeToString(sum[:])+".jpg"), nil
+}
+
+func (s *server) thumbnail(name string, info fs.FileInfo) (string, error) {
+   abs := filepath.Join(s.dir, filepath.FromSlash(name))
+   cache, err := cache_name(abs, info)
+   if err != nil {
+      return "", err
+   }
+   if _, err := os.Stat(cache); err == nil {
+      return cache, nil
+   }
+   thumb_limit <- struct{}{}
+   defer func() { <-thumb_limit }()
+   var img image.Image
+   if _, video := kind(name); video {
+      img, err = poster(abs)
+   } else {
+      img, err = s.decode(name)
+   }
+   if err != nil {
+      return "", err
+   }
+   var data bytes.Buffer
+   err = jpeg.Encode(&data, scale(img, thumb_size), &jpeg.Options{Quality: 80})
+   if err != nil {
+      return "", err
+   }
+   err = os.MkdirAll(filepath.Dir(cache), os.ModePerm)
+   if err != nil {
+      return "", err
+   }
+   // rename, so a reader never sees half a file
+   temp := fmt.Sprint(cache, ".", time.Now().UnixNano())
+   err = os.WriteFile(temp, data.Bytes(), 0666)
+   if err != nil {
+      return "", err
+   }
+   return cache, os.Rename(temp, cache)
+}
+
+func (s *server) decode(name string) (image.Image, error) {
+   file, err := s.root.Open(name)
+   if err != nil {
+      return nil, err
+   }
+   defer file.Close()
+   img, _, err := image.Decode(file)
+   return img, err
+}
+
+// the same ffmpeg call video-to-image makes, every frame from 5 seconds in.
+// short videos have nothing there, so try again from the start
+func poster(abs string) (image.Image, error) {
+   temp, err := os.MkdirTemp("", "file-serve")
+   if err != nil {
+      return nil, err
+   }
+   defer os.RemoveAll(temp)
+   for _, start := range []string{"5", ""} {
+      arg := []string{"-a", "-d", "0.1", "-i", abs}
+      if start != "" {
+         arg = append(arg, "-s", start)
+      }
+      command := exec.Command("video-to-image", arg...)
+      command.Dir = temp
+      output, err := command.CombinedOutput()
+      if err != nil {
+         return nil, fmt.Errorf("%v\n%s", err, output)
+      }
+      file, err := os.Open(filepath.Join(temp, "1.jpg"))
+      if err != nil {
+         continue
+      }
+      defer file.Close()
+      return jpeg.Decode(file)
+   }
+   return nil, errors.New("no frames")
+}
+
+// box filter, each pixel is the mean of the ones it covers. big boxes are
+// sampled, since a phone photo is tens of millions of At calls
+func scale(src image.Image, size int) image.Image {
+   bounds := src.Bounds()
+   width, height := bounds.Dx(), bounds.Dy()
+   if width <= size && height <= size {
+      return src
+   }
+   x_size, y_size := size, size
+   if width > height {
+      y_size = max(1, height*size/width)
+   } else {
+      x_size = max(1, width*size/height)
+   }
+   dst := image.NewRGBA(image.Rect(0, 0, x_size, y_size))
+   for y := range y_size {
+      y0 := bounds.Min.Y + y*height/y_size
+      y1 := max(y0+1, bounds.Min.Y+(y+1)*height/y_size)
+      y_step := max(1, (y1-y0)/4)
+      for x := range x_size {
+         x0 := bounds.Min.X + x*width/x_size
+         x1 := max(x0+1, bounds.Min.X+(x+1)*width/x_size)
+         x_step := max(1, (x1-x0)/4)
+         var r, g, b, a, n uint64
+         for sy := y0; sy < y1; sy += y_step {
+            for sx := x0; sx < x1; sx += x_step {
+               r2, g2, b2, a2 := src.At(sx, sy).RGBA()
+               r += uint64(r2)
+               g += uint64(g2)
+               b += uint64(b2)
+               a += uint64(a2)
+               n++
+            }
+         }
+         dst.Set(x, y, color.RGBA64{
+            uint16(r / n), uint16(g / n), uint16(b / n), uint16(a / n),
+         })
+      }
+   }
+   return dst
+}
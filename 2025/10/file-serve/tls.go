@@ -0,0 +1,79 @@
+package main
+
+import (
+   "crypto/ecdsa"
+   "crypto/elliptic"
+   "crypto/rand"
+   "crypto/sha256"
+   "crypto/tls"
+   "crypto/x509"
+   "crypto/x509/pkix"
+   "fmt"
+   "math/big"
+   "net"
+   "time"
+)
+
+// kept in memory only, so every run has a new one. the fingerprint is printed
+// to compare with what the browser shows
+func self_signed() (*tls.Certificate, error) {
+   key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+   if err != nil {
+      return nil, err
+   }
+   serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+   if err != nil {
+      return nil, err
+   }
+   now := time.Now()
+   template := x509.Certificate{
+      SerialNumber: serial,
+      Subject:      pkix.Name{CommonName: "file-serve"},
+      NotBefore:    now.Add(-time.Hour),
+      NotAfter:     now.AddDate(0, 0, 30),
+      KeyUsage:     x509.KeyUsageDigitalSignature,
+      ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+      DNSNames:     []string{"localhost"},
+      IPAddresses:  addresses(),
+   }
+   der, err := x509.CreateCertificate(
+      rand.Reader, &template, &template, &key.PublicKey, key,
+   )
+   if err != nil {
+      return nil, err
+   }
+   fmt.Printf("sha256 %X\n", sha256.Sum256(der))
+   return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+func tls_config(cert, key string) (*tls.Config, error) {
+   if cert != "" {
+      pair, err := tls.LoadX509KeyPair(cert, key)
+      if err != nil {
+         return nil, err
+      }
+      return &tls.Config{Certificates: []tls.Certificate{pair}}, nil
+   }
+   pair, err := self_signed()
+   if err != nil {
+      return nil, err
+   }
+   return &tls.Config{Certificates: []tls.Certificate{*pair}}, nil
+}
+
+// loopback first
+func addresses() []net.IP {
+   ips := []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+   addrs, err := net.InterfaceAddrs()
+   if err != nil {
+      return ips
+   }
+   for _, addr := range addrs {
+      prefix, ok := addr.(*net.IPNet)
+      if !ok || prefix.IP.IsLoopback() || prefix.IP.IsLinkLocalUnicast() {
+         continue
+      }
+      ips = append(ips, prefix.IP)
+   }
+   return ips
+}
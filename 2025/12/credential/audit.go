@@ -0,0 +1,234 @@
+package main
+
+import (
+   "flag"
+   "fmt"
+   "math"
+   "strings"
+   "time"
+   "unicode"
+)
+
+func do_audit(arg []string) error {
+   set := flag.NewFlagSet("audit", flag.ExitOnError)
+   store := set.String("s", "", "store name or path, comma separated")
+   days := set.Int("d", 365, "stale after days")
+   length := set.Int("l", 12, "minimum length")
+   bits := set.Float64("b", 60, "minimum entropy bits")
+   set.Parse(arg)
+   names, err := get_stores(*store)
+   if err != nil {
+      return err
+   }
+   var entries []entry
+   for _, name := range names {
+      users, err := get_users(name)
+      if err != nil {
+         return err
+      }
+      for _, user := range users {
+         entries = append(entries, entry{store_name(name), user})
+      }
+   }
+   var a audit
+   a.reused(entries)
+   a.weak(entries, *length, *bits)
+   a.stale(entries, *days)
+   a.hosts(entries)
+   a.trial(entries)
+   fmt.Print(&a)
+   return nil
+}
+
+type entry struct {
+   store string
+   user  userinfo
+}
+
+func (e entry) String() string {
+   return e.store + " " + e.user["host"] + " " + e.user["user"]
+}
+
+type audit struct {
+   data strings.Builder
+}
+
+func (a *audit) String() string {
+   return a.data.String()
+}
+
+func (a *audit) section(title string, lines []string) {
+   if len(lines) == 0 {
+      return
+   }
+   if a.data.Len() >= 1 {
+      a.data.WriteByte('\n')
+   }
+   a.data.WriteString(title)
+   for _, line := range lines {
+      a.data.WriteString("\n   ")
+      a.data.WriteString(line)
+   }
+   a.data.WriteByte('\n')
+}
+
+// a trial password may be shared, but only among trial entries
+func (a *audit) reused(entries []entry) {
+   var passwords []string
+   groups := map[string][]entry{}
+   for _, e := range entries {
+      password := e.user["password"]
+      if password == "" {
+         continue
+      }
+      if _, ok := groups[password]; !ok {
+         passwords = append(passwords, password)
+      }
+      groups[password] = append(groups[password], e)
+   }
+   var reused int
+   for _, password := range passwords {
+      group := groups[password]
+      if len(group) == 1 {
+         continue
+      }
+      trial := true
+      for _, e := range group {
+         if e.user["trial"] != "true" {
+            trial = false
+         }
+      }
+      if trial {
+         continue
+      }
+      var lines []string
+      for _, e := range group {
+         lines = append(lines, e.String())
+      }
+      reused++
+      a.section(fmt.Sprint("reused password ", reused), lines)
+   }
+}
+
+func (a *audit) weak(entries []entry, length int, bits float64) {
+   var lines []string
+   for _, e := range entries {
+      password := e.user["password"]
+      if password == "" {
+         continue
+      }
+      var s strength
+      s.New(password)
+      if s.length < length || s.classes < 3 || s.bits < bits {
+         lines = append(lines, fmt.Sprintf("%v (%v)", e, &s))
+      }
+   }
+   a.section("weak password", lines)
+}
+
+func (a *audit) stale(entries []entry, days int) {
+   // dates are compared as strings, same as time.DateOnly
+   before := time.Now().AddDate(0, 0, -days).Format(time.DateOnly)
+   var lines []string
+   for _, e := range entries {
+      date := e.user["date"]
+      if date < before {
+         if date == "" {
+            date = "no date"
+         }
+         lines = append(lines, fmt.Sprintf("%v (%v)", e, date))
+      }
+   }
+   a.section("stale", lines)
+}
+
+func (a *audit) hosts(entries []entry) {
+   var hosts []string
+   groups := map[string][]entry{}
+   for _, e := range entries {
+      host := e.user["host"]
+      if host == "" {
+         continue
+      }
+      if _, ok := groups[host]; !ok {
+         hosts = append(hosts, host)
+      }
+      groups[host] = append(groups[host], e)
+   }
+   var lines []string
+   for _, host := range hosts {
+      if len(groups[host]) >= 2 {
+         for _, e := range groups[host] {
+            lines = append(lines, e.String())
+         }
+      }
+   }
+   a.section("duplicate host", lines)
+}
+
+// every password needs trial = true or trial = false
+func (a *audit) trial(entries []entry) {
+   var lines []string
+   for _, e := range entries {
+      if e.user["password"] == "" {
+         continue
+      }
+      switch e.user["trial"] {
+      case "true", "false":
+      default:
+         lines = append(lines, e.String())
+      }
+   }
+   a.section("missing trial", lines)
+}
+
+type strength struct {
+   length  int
+   classes int
+   bits    float64
+}
+
+// estimate assumes every character is drawn at random from the classes
+// present, so it is an upper bound
+func (s *strength) New(password string) {
+   var lower, upper, digit, other bool
+   for _, r := range password {
+      s.length++
+      switch {
+      case unicode.IsLower(r):
+         lower = true
+      case unicode.IsUpper(r):
+         upper = true
+      case unicode.IsDigit(r):
+         digit = true
+      default:
+         other = true
+      }
+   }
+   var pool int
+   if lower {
+      s.classes++
+      pool += 26
+   }
+   if upper {
+      s.classes++
+      pool += 26
+   }
+   if digit {
+      s.classes++
+      pool += 10
+   }
+   if other {
+      s.classes++
+      pool += 33
+   }
+   if pool >= 1 {
+      s.bits = float64(s.length) * math.Log2(float64(pool))
+   }
+}
+
+func (s *strength) String() string {
+   return fmt.Sprintf(
+      "%v characters, %v classes, %.0f bits", s.length, s.classes, s.bits,
+   )
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+   "context"
+   "encoding/base64"
+   "io"
+   "log"
+   "os"
+   "os/signal"
+   "time"
+)
+
+// OSC 52 is handled by the terminal, so it works over SSH without a native
+// clipboard
+func osc52(data string) string {
+   return "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(data)) + "\a"
+}
+
+func clipboard(data string, timeout time.Duration) error {
+   var out io.Writer = os.Stdout
+   // write to the terminal even if stdout is redirected
+   tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+   if err == nil {
+      defer tty.Close()
+      out = tty
+   }
+   _, err = io.WriteString(out, osc52(data))
+   if err != nil {
+      return err
+   }
+   if timeout <= 0 {
+      return nil
+   }
+   log.Print("clipboard clears in ", timeout)
+   ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+   defer stop()
+   select {
+   case <-time.After(timeout):
+   case <-ctx.Done():
+   }
+   // empty payload clears the selection
+   _, err = io.WriteString(out, osc52(""))
+   return err
+}
@@ -2,17 +2,18 @@ package main
 
 import (
    "encoding/json"
-   "errors"
    "flag"
    "fmt"
    "log"
+   "maps"
    "os"
+   "path/filepath"
    "slices"
    "strings"
    "time"
 )
 
-func get_users() ([]userinfo, error) {
+func get_users(name string) ([]userinfo, error) {
    data, err := os.ReadFile(name)
    if err != nil {
       return nil, err
@@ -22,48 +23,99 @@ func get_users() ([]userinfo, error) {
    if err != nil {
       return nil, err
    }
-   passwords := map[string]bool{}
-   for _, user := range users {
-      trial := user["trial"]
-      password := user["password"]
-      if trial == "true" {
-         trial2, ok := passwords[password]
-         if ok {
-            if !trial2 {
-               return nil, errors.New(password)
-            }
-         } else {
-            passwords[password] = true
-         }
-      } else if trial == "false" {
-         _, ok := passwords[password]
-         if ok {
-            return nil, errors.New(password)
-         } else {
-            passwords[password] = false
-         }
-      } else if password != "" {
-         return nil, fmt.Errorf("%v", user)
-      }
+   return users, nil
+}
+
+func write_users(name string, users []userinfo) error {
+   data, err := json.MarshalIndent(users, "", "   ")
+   if err != nil {
+      return err
    }
-   year_ago := time.Now().AddDate(-1, 0, 0).String()
-   for _, user := range users {
-      if user["date"] < year_ago {
-         return nil, fmt.Errorf("%v", user)
-      }
+   err = os.MkdirAll(filepath.Dir(name), 0700)
+   if err != nil {
+      return err
    }
-   return users, nil
+   // temp file and rename, so a crash or a full disk leaves the old store
+   file, err := os.CreateTemp(filepath.Dir(name), ".credential-*")
+   if err != nil {
+      return err
+   }
+   defer os.Remove(file.Name())
+   _, err = file.Write(data)
+   if err == nil {
+      err = file.Sync()
+   }
+   if err2 := file.Close(); err == nil {
+      err = err2
+   }
+   if err != nil {
+      return err
+   }
+   return os.Rename(file.Name(), name)
 }
 
 type userinfo map[string]string
 
-const name = `D:\backblaze\largest\credential.json`
+var commands = map[string]func([]string) error{
+   "audit":  do_audit,
+   "gen":    do_gen,
+   "import": do_import,
+}
+
+// flag, then environment, then every store in the config directory
+func get_stores(value string) ([]string, error) {
+   if value == "" {
+      value = os.Getenv("CREDENTIAL")
+   }
+   dir, err := os.UserConfigDir()
+   if err != nil {
+      return nil, err
+   }
+   dir = filepath.Join(dir, "credential")
+   if value == "" {
+      names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+      if err != nil {
+         return nil, err
+      }
+      if len(names) >= 1 {
+         return names, nil
+      }
+      return []string{filepath.Join(dir, "credential.json")}, nil
+   }
+   var names []string
+   for _, name := range strings.Split(value, ",") {
+      // "work" is a named store, anything else is a path
+      if filepath.Base(name) == name && filepath.Ext(name) == "" {
+         name = filepath.Join(dir, name+".json")
+      }
+      names = append(names, name)
+   }
+   return names, nil
+}
+
+func store_name(name string) string {
+   return strings.TrimSuffix(filepath.Base(name), ".json")
+}
 
 func main() {
+   if len(os.Args) >= 2 {
+      command, ok := commands[os.Args[1]]
+      if ok {
+         err := command(os.Args[2:])
+         if err != nil {
+            log.Fatal(err)
+         }
+         return
+      }
+   }
    key := flag.String("k", "password", "key")
    host := flag.String("h", "", "host")
    user := flag.String("u", "", "user")
    contains := flag.String("c", "", "contains")
+   store := flag.String("s", "", "store name or path, comma separated")
+   clip := flag.Bool("x", false, "copy to clipboard instead of printing")
+   timeout := flag.Duration("t", 45*time.Second, "clear clipboard after")
+   raw := flag.Bool("r", false, "show secrets with -c")
    flag.Parse()
    if *key == "password" {
       if *contains == "" {
@@ -73,41 +125,84 @@ func main() {
          }
       }
    }
-   users, err := get_users()
+   names, err := get_stores(*store)
    if err != nil {
       log.Fatal(err)
    }
    var line bool
-   for _, user2 := range users {
-      if *contains != "" {
-         if strings.Contains(user2.String(), *contains) {
-            if line {
-               fmt.Println()
-            } else {
-               line = true
+   for _, name := range names {
+      users, err := get_users(name)
+      if err != nil {
+         log.Fatal(err)
+      }
+      for _, user2 := range users {
+         if *contains != "" {
+            // match what is shown, so a search cannot probe the secrets
+            if !*raw {
+               user2 = user2.mask()
             }
-            fmt.Println(user2)
-         }
-      } else {
-         if user2[*key] == "" {
-            continue
-         }
-         if *host != "" {
-            if user2["host"] != *host {
-               continue
+            if strings.Contains(user2.String(), *contains) {
+               if line {
+                  fmt.Println()
+               } else {
+                  line = true
+               }
+               if len(names) >= 2 {
+                  fmt.Println("store =", store_name(name))
+               }
+               fmt.Println(user2)
             }
-         }
-         if *user != "" {
-            if user2["user"] != *user {
+         } else {
+            if user2[*key] == "" {
                continue
             }
+            if *host != "" {
+               if user2["host"] != *host {
+                  continue
+               }
+            }
+            if *user != "" {
+               if user2["user"] != *user {
+                  continue
+               }
+            }
+            value := user2[*key]
+            if *key == "totp" {
+               var code totp
+               err := code.New(value)
+               if err != nil {
+                  log.Fatal(err)
+               }
+               var remaining time.Duration
+               value, remaining = code.code(time.Now())
+               log.Print(remaining, " remaining")
+            }
+            if *clip {
+               err := clipboard(value, *timeout)
+               if err != nil {
+                  log.Fatal(err)
+               }
+            } else {
+               fmt.Print(value)
+            }
+            return
          }
-         fmt.Print(user2[*key])
-         return
       }
    }
 }
 
+var secrets = []string{"password", "previous", "totp"}
+
+func (u userinfo) mask() userinfo {
+   masked := maps.Clone(u)
+   for _, key := range secrets {
+      if masked[key] != "" {
+         masked[key] = "********"
+      }
+   }
+   return masked
+}
+
 func (u userinfo) String() string {
    keys := make([]string, 0, len(u))
    for key := range u {
@@ -0,0 +1,190 @@
+package main
+
+import (
+   "crypto/rand"
+   "errors"
+   "flag"
+   "fmt"
+   "io/fs"
+   "log"
+   "math/big"
+   "strconv"
+   "strings"
+   "time"
+)
+
+func do_gen(arg []string) error {
+   set := flag.NewFlagSet("gen", flag.ExitOnError)
+   host := set.String("h", "", "host")
+   user := set.String("u", "", "user")
+   rule := set.String("r", "", `rule, for example "length=16 symbol=!#$"`)
+   store := set.String("s", "", "store name or path, comma separated")
+   force := set.Bool("f", false, "replace an existing password")
+   set.Parse(arg)
+   if *host == "" {
+      set.Usage()
+      return nil
+   }
+   names, err := get_stores(*store)
+   if err != nil {
+      return err
+   }
+   for _, name := range names {
+      users, err := get_users(name)
+      if err != nil {
+         // a store not made yet, the new entry code below creates it
+         if errors.Is(err, fs.ErrNotExist) {
+            continue
+         }
+         return err
+      }
+      for _, user2 := range users {
+         if user2["host"] != *host {
+            continue
+         }
+         if *user != "" {
+            if user2["user"] != *user {
+               continue
+            }
+         }
+         if user2["password"] != "" {
+            if !*force {
+               return fmt.Errorf("%v has a password, use -f to replace it", *host)
+            }
+            user2["previous"] = user2["password"]
+         }
+         err := user2.generate(*rule)
+         if err != nil {
+            return err
+         }
+         log.Print(name)
+         return write_users(name, users)
+      }
+   }
+   // new entry goes in the first store
+   users, err := get_users(names[0])
+   if err != nil && !errors.Is(err, fs.ErrNotExist) {
+      return err
+   }
+   user2 := userinfo{"host": *host, "trial": "false"}
+   if *user != "" {
+      user2["user"] = *user
+   }
+   err = user2.generate(*rule)
+   if err != nil {
+      return err
+   }
+   log.Print(names[0])
+   return write_users(names[0], append(users, user2))
+}
+
+// rule is kept on the entry, so the next gen for the host follows it
+func (u userinfo) generate(rule string) error {
+   if rule != "" {
+      u["rule"] = rule
+   }
+   var p password_rule
+   err := p.New(u["rule"])
+   if err != nil {
+      return err
+   }
+   password, err := p.generate()
+   if err != nil {
+      return err
+   }
+   u["password"] = password
+   u["date"] = time.Now().Format(time.DateOnly)
+   return nil
+}
+
+type password_rule struct {
+   length int
+   symbol string
+}
+
+func (p *password_rule) New(rule string) error {
+   p.length = 20
+   p.symbol = "!#$%&*+-=?@^_"
+   for _, field := range strings.Fields(rule) {
+      key, value, _ := strings.Cut(field, "=")
+      switch key {
+      case "length":
+         var err error
+         p.length, err = strconv.Atoi(value)
+         if err != nil {
+            return err
+         }
+      case "symbol":
+         // passwords are picked a byte at a time
+         for _, r := range value {
+            if r <= ' ' || r > '~' {
+               return fmt.Errorf("symbol %q is not printable ASCII", r)
+            }
+         }
+         p.symbol = value
+      default:
+         return fmt.Errorf("rule %q", field)
+      }
+   }
+   return nil
+}
+
+// every class in the rule appears at least once
+func (p *password_rule) generate() (string, error) {
+   classes := []string{
+      "abcdefghijklmnopqrstuvwxyz",
+      "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+      "0123456789",
+   }
+   if p.symbol != "" {
+      classes = append(classes, p.symbol)
+   }
+   if p.length < len(classes) {
+      return "", fmt.Errorf("length %v", p.length)
+   }
+   all := strings.Join(classes, "")
+   password := make([]byte, p.length)
+   for i := range password {
+      c, err := random_byte(all)
+      if err != nil {
+         return "", err
+      }
+      password[i] = c
+   }
+   // shuffle the positions, then give the first ones a class each
+   positions := make([]int, p.length)
+   for i := range positions {
+      positions[i] = i
+   }
+   for i := len(positions) - 1; i >= 1; i-- {
+      j, err := random(i + 1)
+      if err != nil {
+         return "", err
+      }
+      positions[i], positions[j] = positions[j], positions[i]
+   }
+   for i, class := range classes {
+      c, err := random_byte(class)
+      if err != nil {
+         return "", err
+      }
+      password[positions[i]] = c
+   }
+   return string(password), nil
+}
+
+func random_byte(s string) (byte, error) {
+   i, err := random(len(s))
+   if err != nil {
+      return 0, err
+   }
+   return s[i], nil
+}
+
+func random(n int) (int, error) {
+   i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+   if err != nil {
+      return 0, err
+   }
+   return int(i.Int64()), nil
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+   "bufio"
+   "bytes"
+   "encoding/csv"
+   "encoding/json"
+   "errors"
+   "flag"
+   "fmt"
+   "io/fs"
+   "net/url"
+   "os"
+   "strconv"
+   "strings"
+   "time"
+)
+
+func do_import(arg []string) error {
+   set := flag.NewFlagSet("import", flag.ExitOnError)
+   store := set.String("s", "", "store name or path, comma separated")
+   yes := set.Bool("y", false, "merge without asking")
+   set.Usage = func() {
+      fmt.Fprintln(set.Output(), "credential import [flags] export.csv")
+      set.PrintDefaults()
+   }
+   set.Parse(arg)
+   if set.NArg() != 1 {
+      set.Usage()
+      return nil
+   }
+   data, err := os.ReadFile(set.Arg(0))
+   if err != nil {
+      return err
+   }
+   imported, err := parse_export(data)
+   if err != nil {
+      return err
+   }
+   names, err := get_stores(*store)
+   if err != nil {
+      return err
+   }
+   seen := map[string]bool{}
+   // new entries go in the first store
+   var users []userinfo
+   for i, name := range names {
+      users2, err := get_users(name)
+      if err != nil {
+         if i == 0 && errors.Is(err, fs.ErrNotExist) {
+            continue
+         }
+         return err
+      }
+      for _, user := range users2 {
+         seen[user.id()] = true
+      }
+      if i == 0 {
+         users = users2
+      }
+   }
+   var fresh []userinfo
+   for _, user := range imported {
+      if seen[user.id()] {
+         continue
+      }
+      seen[user.id()] = true
+      fresh = append(fresh, user)
+   }
+   for i, user := range fresh {
+      if i >= 1 {
+         fmt.Println()
+      }
+      fmt.Println(user.mask())
+   }
+   fmt.Fprintf(
+      os.Stderr, "%v new, %v duplicate\n",
+      len(fresh), len(imported)-len(fresh),
+   )
+   if len(fresh) == 0 {
+      return nil
+   }
+   if !*yes {
+      fmt.Fprintf(os.Stderr, "merge into %v? [y/N] ", names[0])
+      answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+      if strings.TrimSpace(strings.ToLower(answer)) != "y" {
+         return nil
+      }
+   }
+   return write_users(names[0], append(users, fresh...))
+}
+
+// entries are the same if host and user are
+func (u userinfo) id() string {
+   return u["host"] + "\x00" + u["user"]
+}
+
+// Bitwarden JSON, or CSV from Firefox, Bitwarden or KeePass
+func parse_export(data []byte) ([]userinfo, error) {
+   data = bytes.TrimPrefix(data, []byte("\uFEFF"))
+   if bytes.HasPrefix(bytes.TrimSpace(data), []byte{'{'}) {
+      return parse_bitwarden(data)
+   }
+   records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+   if err != nil {
+      return nil, err
+   }
+   if len(records) == 0 {
+      return nil, nil
+   }
+   index := map[string]int{}
+   for i, column := range records[0] {
+      key, ok := columns[strings.ToLower(column)]
+      if ok {
+         if _, ok := index[key]; !ok {
+            index[key] = i
+         }
+      }
+   }
+   if _, ok := index["password"]; !ok {
+      return nil, fmt.Errorf("unknown export %q", records[0])
+   }
+   var users []userinfo
+   for _, record := range records[1:] {
+      value := func(key string) string {
+         i, ok := index[key]
+         if ok && i < len(record) {
+            return record[i]
+         }
+         return ""
+      }
+      host := value("host")
+      if host == "" {
+         host = value("name")
+      }
+      user := new_userinfo(host, value("user"), value("password"))
+      if user == nil {
+         continue
+      }
+      if totp := value("totp"); totp != "" {
+         user["totp"] = totp
+      }
+      if date := export_date(value("date")); date != "" {
+         user["date"] = date
+      }
+      users = append(users, user)
+   }
+   return users, nil
+}
+
+var columns = map[string]string{
+   // Firefox
+   "url":                 "host",
+   "username":            "user",
+   "password":            "password",
+   "timepasswordchanged": "date",
+   // Bitwarden
+   "name":           "name",
+   "login_uri":      "host",
+   "login_username": "user",
+   "login_password": "password",
+   "login_totp":     "totp",
+   // KeePassXC
+   "title":         "name",
+   "totp":          "totp",
+   "last modified": "date",
+   // KeePass 2
+   "account":    "name",
+   "login name": "user",
+   "web site":   "host",
+}
+
+func parse_bitwarden(data []byte) ([]userinfo, error) {
+   var export struct {
+      Items []struct {
+         Name         string
+         RevisionDate string
+         Login        *struct {
+            Uris []struct {
+               Uri string
+            }
+            Username string
+            Password string
+            Totp     string
+         }
+      }
+   }
+   err := json.Unmarshal(data, &export)
+   if err != nil {
+      return nil, err
+   }
+   var users []userinfo
+   for _, item := range export.Items {
+      login := item.Login
+      if login == nil {
+         continue
+      }
+      host := item.Name
+      if len(login.Uris) >= 1 {
+         host = login.Uris[0].Uri
+      }
+      user := new_userinfo(host, login.Username, login.Password)
+      if user == nil {
+         continue
+      }
+      if login.Totp != "" {
+         user["totp"] = login.Totp
+      }
+      if date := export_date(item.RevisionDate); date != "" {
+         user["date"] = date
+      }
+      users = append(users, user)
+   }
+   return users, nil
+}
+
+func new_userinfo(host, user, password string) userinfo {
+   if password == "" {
+      return nil
+   }
+   if strings.Contains(host, "://") {
+      address, err := url.Parse(host)
+      if err == nil && address.Hostname() != "" {
+         host = address.Hostname()
+      }
+   }
+   info := userinfo{"host": host, "password": password, "trial": "false"}
+   if user != "" {
+      info["user"] = user
+   }
+   return info
+}
+
+// milliseconds from Firefox, RFC 3339 from the others
+func export_date(value string) string {
+   if value == "" {
+      return ""
+   }
+   if milli, err := strconv.ParseInt(value, 10, 64); err == nil {
+      return time.UnixMilli(milli).Format(time.DateOnly)
+   }
+   if date, err := time.Parse(time.RFC3339, value); err == nil {
+      return date.Format(time.DateOnly)
+   }
+   if len(value) >= 10 {
+      return value[:10]
+   }
+   return ""
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+   "crypto/hmac"
+   "crypto/sha1"
+   "crypto/sha256"
+   "crypto/sha512"
+   "encoding/base32"
+   "encoding/binary"
+   "fmt"
+   "hash"
+   "net/url"
+   "strconv"
+   "strings"
+   "time"
+)
+
+// RFC 6238
+type totp struct {
+   secret    []byte
+   algorithm func() hash.Hash
+   digits    int
+   period    int64
+}
+
+// base32 secret, or
+// otpauth://totp/label?secret=BASE32&algorithm=SHA256&digits=8&period=60
+func (t *totp) New(value string) error {
+   t.algorithm = sha1.New
+   t.digits = 6
+   t.period = 30
+   secret := value
+   if strings.HasPrefix(value, "otpauth://") {
+      address, err := url.Parse(value)
+      if err != nil {
+         return err
+      }
+      query := address.Query()
+      secret = query.Get("secret")
+      switch strings.ToUpper(query.Get("algorithm")) {
+      case "", "SHA1":
+      case "SHA256":
+         t.algorithm = sha256.New
+      case "SHA512":
+         t.algorithm = sha512.New
+      default:
+         return fmt.Errorf("algorithm %q", query.Get("algorithm"))
+      }
+      if digits := query.Get("digits"); digits != "" {
+         t.digits, err = strconv.Atoi(digits)
+         if err != nil {
+            return err
+         }
+      }
+      if period := query.Get("period"); period != "" {
+         t.period, err = strconv.ParseInt(period, 10, 64)
+         if err != nil {
+            return err
+         }
+      }
+   }
+   // 10 digits is the most a 31 bit value can fill
+   if t.digits < 1 || t.digits > 10 {
+      return fmt.Errorf("digits %v", t.digits)
+   }
+   if t.period < 1 {
+      return fmt.Errorf("period %v", t.period)
+   }
+   secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+   var err error
+   t.secret, err = base32.StdEncoding.WithPadding(base32.NoPadding).
+      DecodeString(strings.TrimRight(secret, "="))
+   return err
+}
+
+// code and time until the next one
+func (t *totp) code(now time.Time) (string, time.Duration) {
+   var counter [8]byte
+   binary.BigEndian.PutUint64(counter[:], uint64(now.Unix()/t.period))
+   mac := hmac.New(t.algorithm, t.secret)
+   mac.Write(counter[:])
+   sum := mac.Sum(nil)
+   offset := sum[len(sum)-1] & 0xf
+   value := uint64(binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff)
+   modulus := uint64(1)
+   for range t.digits {
+      modulus *= 10
+   }
+   remaining := t.period - now.Unix()%t.period
+   return fmt.Sprintf("%0*d", t.digits, value%modulus),
+      time.Duration(remaining) * time.Second
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+   "cmp"
+   "fmt"
+   "path"
+   "slices"
+   "strconv"
+   "strings"
+)
+
+type stat struct {
+   Name   string `json:"name"`
+   Add    int    `json:"add"`
+   Delete int    `json:"delete"`
+   Binary bool   `json:"-"`
+}
+
+// binary files are "-\t-\thello.png"
+func parse_numstat(text string) []stat {
+   var stats []stat
+   // split fails on empty string
+   for _, line := range strings.FieldsFunc(text, lines) {
+      add, line, _ := strings.Cut(line, "\t")
+      del, name, _ := strings.Cut(line, "\t")
+      file := stat{Name: name}
+      if add == "-" {
+         file.Binary = true
+      } else {
+         file.Add, _ = strconv.Atoi(add)
+         file.Delete, _ = strconv.Atoi(del)
+      }
+      stats = append(stats, file)
+   }
+   return stats
+}
+
+func (g *git_board) keep(name string) bool {
+   if len(g.include) >= 1 {
+      if !slices.ContainsFunc(g.include, func(pattern string) bool {
+         return match(pattern, name)
+      }) {
+         return false
+      }
+   }
+   return !slices.ContainsFunc(g.exclude, func(pattern string) bool {
+      return match(pattern, name)
+   })
+}
+
+// a pattern matches the path or the base name. with a trailing slash it
+// matches every file under a directory, for example "vendor/"
+func match(pattern, name string) bool {
+   if dir, ok := strings.CutSuffix(pattern, "/"); ok {
+      for name = path.Dir(name); name != "."; name = path.Dir(name) {
+         if match(dir, name) {
+            return true
+         }
+      }
+      return false
+   }
+   if ok, _ := path.Match(pattern, name); ok {
+      return true
+   }
+   ok, _ := path.Match(pattern, path.Base(name))
+   return ok
+}
+
+func (s stat) churn() int {
+   return s.Add + s.Delete
+}
+
+// most churn first
+func sort_stats(stats []stat) {
+   slices.SortStableFunc(stats, func(a, b stat) int {
+      return cmp.Compare(b.churn(), a.churn())
+   })
+}
+
+func group_stats(files []stat, key func(string) string) []stat {
+   var groups []stat
+   index := map[string]int{}
+   for _, file := range files {
+      name := key(file.Name)
+      i, ok := index[name]
+      if !ok {
+         i = len(groups)
+         index[name] = i
+         groups = append(groups, stat{Name: name})
+      }
+      groups[i].Add += file.Add
+      groups[i].Delete += file.Delete
+   }
+   sort_stats(groups)
+   return groups
+}
+
+func extension(name string) string {
+   ext := path.Ext(name)
+   if ext == "" {
+      return "(none)"
+   }
+   return ext
+}
+
+// only commits have an author, so this needs -r
+func (g *git_board) authors(since string) ([]stat, error) {
+   if since == "HEAD" {
+      return nil, fmt.Errorf("group author needs -r")
+   }
+   text, err := git(
+      g.Dir, "log", "--numstat", "--no-renames", "--format=%x00%aN",
+      since+"..HEAD",
+   )
+   if err != nil {
+      return nil, err
+   }
+   var (
+      author  string
+      authors []stat
+   )
+   index := map[string]int{}
+   for _, line := range strings.FieldsFunc(text, lines) {
+      if name, ok := strings.CutPrefix(line, "\x00"); ok {
+         author = name
+         continue
+      }
+      for _, file := range parse_numstat(line) {
+         if !g.keep(file.Name) {
+            continue
+         }
+         i, ok := index[author]
+         if !ok {
+            i = len(authors)
+            index[author] = i
+            authors = append(authors, stat{Name: author})
+         }
+         authors[i].Add += file.Add
+         authors[i].Delete += file.Delete
+      }
+   }
+   sort_stats(authors)
+   return authors, nil
+}
+
+func write_breakdown(boards []git_board, top int, group, since string) error {
+   for _, board := range boards {
+      var title string
+      if len(boards) >= 2 {
+         title = board.Dir + " "
+      }
+      if top >= 1 {
+         files := slices.Clone(board.Files)
+         sort_stats(files)
+         write_stats(title+"top files", files[:min(top, len(files))])
+      }
+      switch group {
+      case "":
+      case "dir":
+         write_stats(title+"by directory", group_stats(board.Files, path.Dir))
+      case "ext":
+         write_stats(title+"by extension", group_stats(board.Files, extension))
+      case "author":
+         authors, err := board.authors(since)
+         if err != nil {
+            return err
+         }
+         write_stats(title+"by author", authors)
+      default:
+         return fmt.Errorf("group %q", group)
+      }
+      if len(board.Binary) >= 1 {
+         fmt.Printf("\n%vbinary files\n", title)
+         for _, name := range board.Binary {
+            fmt.Print("   ", name, "\n")
+         }
+      }
+   }
+   return nil
+}
+
+func write_stats(title string, stats []stat) {
+   fmt.Printf("\n%v\n", title)
+   for _, s := range stats {
+      fmt.Printf("   +%v\t-%v\t%v\n", s.Add, s.Delete, s.Name)
+   }
+}
@@ -1,111 +1,337 @@
 package main
 
 import (
+   "encoding/json"
+   "errors"
+   "flag"
    "fmt"
+   "io/fs"
    "log"
    "os"
    "os/exec"
+   "path/filepath"
+   "slices"
    "strings"
+   "text/tabwriter"
    "text/template"
-   "time"
 )
 
-func (g *git_board) New() error {
-   cmd := exec.Command("git", "add", ".")
-   fmt.Println(cmd.Args)
-   err := cmd.Run()
+func (g *git_board) New(mode, since string) error {
+   err := g.config()
    if err != nil {
       return err
    }
-   cmd = exec.Command("git", "diff", "--cached", "--numstat")
-   fmt.Println(cmd.Args)
-   text, err := cmd.Output()
+   text, err := numstat(g.Dir, mode, since)
    if err != nil {
       return err
    }
-   // split fails on empty string
-   for _, line := range strings.FieldsFunc(string(text), lines) {
-      var add, del int
-      // binary files will be "- - hello.txt", so ignore error
-      fmt.Sscan(line, &add, &del)
+   for _, file := range parse_numstat(text) {
+      if !g.keep(file.Name) {
+         continue
+      }
+      if file.Binary {
+         g.Binary = append(g.Binary, file.Name)
+      } else {
+         g.Files = append(g.Files, file)
+      }
       // Add
-      g.Add += add
+      g.Add += file.Add
       // Delete
-      g.Delete += del
+      g.Delete += file.Delete
       // Change
       g.Change++
    }
-   g.Target = 100
-   if g.Add >= g.Target {
-      g.AddStatus = pass
-   } else {
-      g.AddStatus = fail
-   }
-   if g.Delete >= g.Target {
-      g.DeleteStatus = pass
-   } else {
-      g.DeleteStatus = fail
-   }
-   if g.Change >= g.Target {
-      g.ChangeStatus = pass
-   } else {
-      g.ChangeStatus = fail
-   }
+   g.AddStatus = status(g.Add >= g.Target.Add)
+   g.DeleteStatus = status(g.Delete >= g.Target.Delete)
+   g.ChangeStatus = status(g.Change >= g.Target.Change)
+   g.Pass = g.Add >= g.Target.Add &&
+      g.Delete >= g.Target.Delete &&
+      g.Change >= g.Target.Change
+   g.Status = status(g.Pass)
    // Then
-   then, err := get_then()
+   then, err := get_then(g.Dir)
    if err != nil {
       return err
    }
    g.Then = then
-   // Now
-   g.Now = time.Now().AddDate(0, 0, -1).String()[:10]
-   if g.Then <= g.Now {
-      g.DateStatus = pass
-   } else {
-      g.DateStatus = fail
-   }
    return nil
 }
 
+// the index is never touched. for the working tree, untracked files are added
+// with --intent-to-add to a copy of the index named by GIT_INDEX_FILE
+func numstat(repo, mode, since string) (string, error) {
+   switch mode {
+   case "staged":
+      return git(repo, "diff", "--cached", "--numstat", "--no-renames", since)
+   case "unstaged", "worktree":
+   default:
+      return "", fmt.Errorf("mode %q", mode)
+   }
+   index, err := git_path(repo, "index")
+   if err != nil {
+      return "", err
+   }
+   dir, err := os.MkdirTemp("", "git-board")
+   if err != nil {
+      return "", err
+   }
+   defer os.RemoveAll(dir)
+   temp := filepath.Join(dir, "index")
+   data, err := os.ReadFile(index)
+   if err == nil {
+      err = os.WriteFile(temp, data, 0666)
+      if err != nil {
+         return "", err
+      }
+   } else if !errors.Is(err, fs.ErrNotExist) {
+      return "", err
+   }
+   env := append(os.Environ(), "GIT_INDEX_FILE="+temp)
+   _, err = git_env(repo, env, "add", "--intent-to-add", ".")
+   if err != nil {
+      return "", err
+   }
+   if mode == "unstaged" {
+      return git_env(repo, env, "diff", "--numstat", "--no-renames")
+   }
+   return git_env(repo, env, "diff", "--numstat", "--no-renames", since)
+}
+
 type git_board struct {
-   Add int
-   AddStatus string
-   Delete int
-   DeleteStatus string
-   Change int
-   ChangeStatus string
-   Target int
-   Then string
-   Now string
-   DateStatus string
+   Dir          string   `json:"dir"`
+   Add          int      `json:"add"`
+   AddStatus    string   `json:"-"`
+   Delete       int      `json:"delete"`
+   DeleteStatus string   `json:"-"`
+   Change       int      `json:"change"`
+   ChangeStatus string   `json:"-"`
+   Target       targets  `json:"target"`
+   Pass         bool     `json:"pass"`
+   Status       string   `json:"-"`
+   Then         string   `json:"last_commit"`
+   Files        []stat   `json:"files,omitempty"`
+   Binary       []string `json:"binary,omitempty"`
+   include      []string
+   exclude      []string
+}
+
+type targets struct {
+   Add    int `json:"add"`
+   Delete int `json:"delete"`
+   Change int `json:"change"`
+}
+
+// .git-board.json in the top level of the repo, for example
+// {"add": 50, "delete": 20, "change": 5, "exclude": ["*.pb.go", "vendor/"]}
+func (g *git_board) config() error {
+   g.Target = targets{Add: 100, Delete: 100, Change: 100}
+   top, err := git(g.Dir, "rev-parse", "--show-toplevel")
+   if err != nil {
+      return err
+   }
+   data, err := os.ReadFile(filepath.Join(top, ".git-board.json"))
+   if err != nil {
+      if errors.Is(err, fs.ErrNotExist) {
+         return nil
+      }
+      return err
+   }
+   var value struct {
+      targets
+      Include []string `json:"include"`
+      Exclude []string `json:"exclude"`
+   }
+   value.targets = g.Target
+   err = json.Unmarshal(data, &value)
+   if err != nil {
+      return err
+   }
+   g.Target = value.targets
+   g.include = append(g.include, value.Include...)
+   g.exclude = append(g.exclude, value.Exclude...)
+   return nil
 }
 
 func main() {
-   var board git_board
-   err := board.New()
+   mode := flag.String("m", "worktree", "worktree, staged or unstaged")
+   since := flag.String("r", "HEAD", "compare with commit")
+   all := flag.Bool("a", false, "every repository in the current directory")
+   output := flag.String("format", "text", "text, json or markdown")
+   top := flag.Int("top", 0, "show the files with the most churn")
+   group := flag.String("group", "", "group churn by dir, ext or author")
+   var include, exclude []string
+   flag.Func("include", "only count paths matching glob", func(s string) error {
+      include = append(include, s)
+      return nil
+   })
+   flag.Func("exclude", "do not count paths matching glob", func(s string) error {
+      exclude = append(exclude, s)
+      return nil
+   })
+   flag.Usage = func() {
+      fmt.Fprintln(
+         flag.CommandLine.Output(), "git-board [flags] [history] [repository...]",
+      )
+      flag.PrintDefaults()
+   }
+   flag.Parse()
+   color = *output == "text" && terminal() && os.Getenv("NO_COLOR") == ""
+   repos := flag.Args()
+   history := len(repos) >= 1 && repos[0] == "history"
+   if history {
+      repos = repos[1:]
+   }
+   if *all {
+      repos2, err := sub_repos()
+      if err != nil {
+         log.Fatal(err)
+      }
+      repos = append(repos, repos2...)
+   }
+   if len(repos) == 0 {
+      repos = []string{"."}
+   }
+   if history {
+      for i, repo := range repos {
+         if len(repos) >= 2 {
+            if i >= 1 {
+               fmt.Println()
+            }
+            fmt.Println(repo)
+         }
+         err := show_history(repo)
+         if err != nil {
+            log.Fatal(err)
+         }
+      }
+      return
+   }
+   var (
+      boards []git_board
+      failed bool
+   )
+   // only the default run goes in the history. other modes and revisions give
+   // numbers that do not compare, and json is polled by status bars
+   record := *output == "text" && *mode == "worktree" && *since == "HEAD"
+   // one broken repo should not hide the others
+   for _, repo := range repos {
+      // config appends to these, so every board needs its own
+      board := git_board{
+         Dir:     repo,
+         include: slices.Clone(include),
+         exclude: slices.Clone(exclude),
+      }
+      err := board.New(*mode, *since)
+      if err == nil && record {
+         err = board.record()
+      }
+      if err != nil {
+         log.Print(repo, " ", err)
+         failed = true
+         continue
+      }
+      boards = append(boards, board)
+   }
+   err := write_boards(boards, *output)
    if err != nil {
       log.Fatal(err)
    }
-   temp, err := new(template.Template).Parse(format)
+   if *output == "text" {
+      err := write_breakdown(boards, *top, *group, *since)
+      if err != nil {
+         log.Fatal(err)
+      }
+   }
+   // for hooks, fail unless every target passed
+   for _, board := range boards {
+      if !board.Pass {
+         failed = true
+      }
+   }
+   if failed {
+      os.Exit(1)
+   }
+}
+
+func write_boards(boards []git_board, output string) error {
+   switch output {
+   case "json":
+      return json.NewEncoder(os.Stdout).Encode(boards)
+   case "markdown":
+      temp, err := new(template.Template).Parse(markdown)
+      if err != nil {
+         return err
+      }
+      return temp.Execute(os.Stdout, boards)
+   case "text":
+      if len(boards) == 1 {
+         temp, err := new(template.Template).Parse(format)
+         if err != nil {
+            return err
+         }
+         return temp.Execute(os.Stdout, boards[0])
+      }
+      temp, err := new(template.Template).Parse(table)
+      if err != nil {
+         return err
+      }
+      tab := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+      err = temp.Execute(tab, boards)
+      if err != nil {
+         return err
+      }
+      return tab.Flush()
+   }
+   return fmt.Errorf("format %q", output)
+}
+
+// same test as git-readdir
+func sub_repos() ([]string, error) {
+   dirs, err := os.ReadDir(".")
    if err != nil {
-      log.Fatal(err)
+      return nil, err
    }
-   if err := temp.Execute(os.Stdout, board); err != nil {
-      log.Fatal(err)
+   var repos []string
+   for _, dir := range dirs {
+      _, err := os.Stat(dir.Name() + "/.git")
+      if err == nil {
+         repos = append(repos, dir.Name())
+      }
    }
+   return repos, nil
 }
 
-func get_then() (string, error) {
-   cmd := exec.Command("git", "log", "-1", "--format=%cI")
-   fmt.Println(cmd.Args)
-   text, err := cmd.Output()
+func get_then(repo string) (string, error) {
+   text, err := git(repo, "log", "-1", "--format=%cI")
    if err != nil {
       return "", err
    }
    if len(text) >= 11 {
       text = text[:10]
    }
-   return string(text), nil
+   return text, nil
+}
+
+func git(repo string, arg ...string) (string, error) {
+   return git_env(repo, nil, arg...)
+}
+
+// stdout is left for the board
+func git_env(repo string, env []string, arg ...string) (string, error) {
+   cmd := exec.Command("git", arg...)
+   cmd.Dir = repo
+   cmd.Env = env
+   log.Print(repo, " ", cmd.Args)
+   text, err := cmd.Output()
+   if err != nil {
+      return "", err
+   }
+   return strings.TrimSpace(string(text)), nil
+}
+
+// absolute, so it does not depend on the repository directory
+func git_path(repo, name string) (string, error) {
+   return git(repo, "rev-parse", "--path-format=absolute", "--git-path", name)
 }
 
 const (
@@ -113,11 +339,59 @@ const (
    pass = "\x1b[30;102m Pass \x1b[m"
 )
 
+// only for a terminal
+var color bool
+
+func status(ok bool) string {
+   if color {
+      if ok {
+         return pass
+      }
+      return fail
+   }
+   if ok {
+      return "Pass"
+   }
+   return "Fail"
+}
+
+func terminal() bool {
+   info, err := os.Stdout.Stat()
+   if err != nil {
+      return false
+   }
+   return info.Mode()&os.ModeCharDevice != 0
+}
+
 const format =
-   "{{ .AddStatus }} additions\ttarget:{{ .Target }}\tactual:{{ .Add }}\n" +
-   "{{ .DeleteStatus }} deletions\ttarget:{{ .Target }}\tactual:{{ .Delete }}\n" +
-   "{{ .ChangeStatus }} changed files\ttarget:{{ .Target}}\tactual:{{ .Change }}\n" +
-   "{{ .DateStatus }} last commit\ttarget:{{ .Then }}\tactual:{{ .Now }}\n"
+   "{{ .AddStatus }} additions\ttarget:{{ .Target.Add }}\tactual:{{ .Add }}\n" +
+   "{{ .DeleteStatus }} deletions\ttarget:{{ .Target.Delete }}\tactual:{{ .Delete }}\n" +
+   "{{ .ChangeStatus }} changed files\ttarget:{{ .Target.Change }}\tactual:{{ .Change }}\n" +
+   "last commit\t{{ .Then }}\n"
+
+// status is last, as tabwriter counts the escapes as width
+const table =
+   "repository\tadditions\tdeletions\tchanged files\tlast commit\tstatus\n" +
+   "{{ range . }}" +
+   "{{ .Dir }}\t" +
+   "{{ .Add }}/{{ .Target.Add }}\t" +
+   "{{ .Delete }}/{{ .Target.Delete }}\t" +
+   "{{ .Change }}/{{ .Target.Change }}\t" +
+   "{{ .Then }}\t" +
+   "{{ .Status }}\n" +
+   "{{ end }}"
+
+const markdown =
+   "| repository | additions | deletions | changed files | last commit | status |\n" +
+   "| --- | --- | --- | --- | --- | --- |\n" +
+   "{{ range . }}" +
+   "| {{ .Dir }} " +
+   "| {{ .Add }}/{{ .Target.Add }} " +
+   "| {{ .Delete }}/{{ .Target.Delete }} " +
+   "| {{ .Change }}/{{ .Target.Change }} " +
+   "| {{ .Then }} " +
+   "| {{ .Status }} |\n" +
+   "{{ end }}"
 
 func lines(r rune) bool {
    return r == '\n'
@@ -0,0 +1,176 @@
+package main
+
+import (
+   "bufio"
+   "encoding/json"
+   "errors"
+   "fmt"
+   "io/fs"
+   "os"
+   "path/filepath"
+   "slices"
+   "time"
+)
+
+type record struct {
+   Time   time.Time `json:"time"`
+   Add    int       `json:"add"`
+   Delete int       `json:"delete"`
+   Change int       `json:"change"`
+   Pass   bool      `json:"pass"`
+}
+
+// kept in the git directory, so it is never committed
+func history_name(repo string) (string, error) {
+   return git_path(repo, "git-board.jsonl")
+}
+
+// one line per day, the last run replaces any earlier one from today. the file
+// is rewritten with a rename, so a crash keeps the old history
+func (g *git_board) record() error {
+   name, err := history_name(g.Dir)
+   if err != nil {
+      return err
+   }
+   days, err := read_history(g.Dir)
+   if err != nil {
+      return err
+   }
+   now := time.Now()
+   if len(days) >= 1 && same_day(days[len(days)-1].Time, now) {
+      days = days[:len(days)-1]
+   }
+   days = append(days, record{
+      Time:   now,
+      Add:    g.Add,
+      Delete: g.Delete,
+      Change: g.Change,
+      Pass:   g.Pass,
+   })
+   file, err := os.CreateTemp(filepath.Dir(name), "git-board-*")
+   if err != nil {
+      return err
+   }
+   defer os.Remove(file.Name())
+   encode := json.NewEncoder(file)
+   for _, day := range days {
+      err = encode.Encode(day)
+      if err != nil {
+         break
+      }
+   }
+   if err2 := file.Close(); err == nil {
+      err = err2
+   }
+   if err != nil {
+      return err
+   }
+   return os.Rename(file.Name(), name)
+}
+
+// the last run of each day counts for that day
+func read_history(repo string) ([]record, error) {
+   name, err := history_name(repo)
+   if err != nil {
+      return nil, err
+   }
+   file, err := os.Open(name)
+   if err != nil {
+      if errors.Is(err, fs.ErrNotExist) {
+         return nil, nil
+      }
+      return nil, err
+   }
+   defer file.Close()
+   var runs []record
+   scan := bufio.NewScanner(file)
+   for scan.Scan() {
+      var run record
+      err := json.Unmarshal(scan.Bytes(), &run)
+      if err != nil {
+         return nil, err
+      }
+      run.Time = run.Time.Local()
+      runs = append(runs, run)
+   }
+   if err := scan.Err(); err != nil {
+      return nil, err
+   }
+   slices.SortStableFunc(runs, func(a, b record) int {
+      return a.Time.Compare(b.Time)
+   })
+   var days []record
+   for _, run := range runs {
+      if len(days) >= 1 {
+         last := &days[len(days)-1]
+         if same_day(last.Time, run.Time) {
+            *last = run
+            continue
+         }
+      }
+      days = append(days, run)
+   }
+   return days, nil
+}
+
+func same_day(a, b time.Time) bool {
+   return a.Format(time.DateOnly) == b.Format(time.DateOnly)
+}
+
+func show_history(repo string) error {
+   days, err := read_history(repo)
+   if err != nil {
+      return err
+   }
+   type week struct {
+      name   string
+      add    int
+      delete int
+      change int
+      pass   int
+      days   int
+   }
+   var weeks []week
+   var current, longest int
+   for i, day := range days {
+      year, number := day.Time.ISOWeek()
+      name := fmt.Sprintf("%v-W%02d", year, number)
+      if len(weeks) == 0 || weeks[len(weeks)-1].name != name {
+         weeks = append(weeks, week{name: name})
+      }
+      w := &weeks[len(weeks)-1]
+      w.add += day.Add
+      w.delete += day.Delete
+      w.change += day.Change
+      w.days++
+      if day.Pass {
+         w.pass++
+         yesterday := day.Time.AddDate(0, 0, -1)
+         if i >= 1 && days[i-1].Pass && same_day(days[i-1].Time, yesterday) {
+            current++
+         } else {
+            current = 1
+         }
+      } else {
+         current = 0
+      }
+      longest = max(longest, current)
+   }
+   // a streak is still going if the last pass was today or yesterday
+   if len(days) >= 1 {
+      last := days[len(days)-1].Time
+      if !same_day(last, time.Now()) {
+         if !same_day(last, time.Now().AddDate(0, 0, -1)) {
+            current = 0
+         }
+      }
+   }
+   for _, w := range weeks {
+      fmt.Printf(
+         "week %v\tadditions:%v\tdeletions:%v\tchanged files:%v\tpassed:%v/%v\n",
+         w.name, w.add, w.delete, w.change, w.pass, w.days,
+      )
+   }
+   fmt.Printf("streak\tcurrent:%v\tlongest:%v\n", current, longest)
+   return nil
+}
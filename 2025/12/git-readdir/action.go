@@ -0,0 +1,84 @@
+package main
+
+import (
+   "bytes"
+   "fmt"
+   "io"
+   "os"
+   "os/exec"
+   "sync"
+)
+
+// "pull" alone is "pull --ff-only", anything else is passed to git
+func action_args(arg []string) []string {
+   if len(arg) == 1 && arg[0] == "pull" {
+      return []string{"pull", "--ff-only"}
+   }
+   return arg
+}
+
+// false if any repo failed
+func do_action(repos []repo, jobs int, arg []string) bool {
+   arg = action_args(arg)
+   var lock sync.Mutex
+   errs := make([]error, len(repos))
+   each(repos, jobs, func(i int, r repo) {
+      stdout := &prefix_writer{out: os.Stdout, lock: &lock, prefix: r.Dir}
+      stderr := &prefix_writer{out: os.Stderr, lock: &lock, prefix: r.Dir}
+      cmd := exec.Command("git", arg...)
+      cmd.Dir = r.Dir
+      // a credential prompt would block the other repos
+      cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+      cmd.Stdout = stdout
+      cmd.Stderr = stderr
+      errs[i] = cmd.Run()
+      stdout.Flush()
+      stderr.Flush()
+   })
+   var failed int
+   for _, err := range errs {
+      if err != nil {
+         failed++
+      }
+   }
+   fmt.Printf("%v ok, %v failed %v\n", len(repos)-failed, failed, arg)
+   for i, err := range errs {
+      if err != nil {
+         fmt.Printf("%v Error %v %v %v\n", invert, reset, repos[i].Dir, err)
+      }
+   }
+   return failed == 0
+}
+
+// whole lines only, so repos running at once do not mix within a line
+type prefix_writer struct {
+   out    io.Writer
+   lock   *sync.Mutex
+   prefix string
+   line   []byte
+}
+
+func (p *prefix_writer) Write(data []byte) (int, error) {
+   p.line = append(p.line, data...)
+   for {
+      i := bytes.IndexByte(p.line, '\n')
+      if i == -1 {
+         return len(data), nil
+      }
+      p.write(p.line[:i])
+      p.line = p.line[i+1:]
+   }
+}
+
+func (p *prefix_writer) Flush() {
+   if len(p.line) >= 1 {
+      p.write(p.line)
+      p.line = nil
+   }
+}
+
+func (p *prefix_writer) write(line []byte) {
+   p.lock.Lock()
+   defer p.lock.Unlock()
+   fmt.Fprintf(p.out, "%v: %s\n", p.prefix, line)
+}
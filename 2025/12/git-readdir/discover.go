@@ -0,0 +1,132 @@
+package main
+
+import (
+   "crypto/sha256"
+   "encoding/hex"
+   "encoding/json"
+   "errors"
+   "fmt"
+   "io/fs"
+   "os"
+   "path/filepath"
+   "slices"
+   "time"
+)
+
+type repo struct {
+   Dir  string `json:"dir"`
+   Bare bool   `json:"bare"`
+}
+
+type repo_cache struct {
+   Time  time.Time `json:"time"`
+   Repos []repo    `json:"repos"`
+}
+
+// cached per directory, depth and skip list
+func cache_name(depth int, skip []string) (string, error) {
+   cache, err := os.UserCacheDir()
+   if err != nil {
+      return "", err
+   }
+   root, err := filepath.Abs(".")
+   if err != nil {
+      return "", err
+   }
+   sum := sha256.Sum256(fmt.Appendf(nil, "%v\n%v\n%q", root, depth, skip))
+   return filepath.Join(
+      cache, "git-readdir", hex.EncodeToString(sum[:8])+".json",
+   ), nil
+}
+
+func find_repos(depth int, skip []string, max_age time.Duration) ([]repo, error) {
+   name, err := cache_name(depth, skip)
+   if err != nil {
+      return nil, err
+   }
+   if max_age >= 1 {
+      data, err := os.ReadFile(name)
+      if err == nil {
+         var cache repo_cache
+         err := json.Unmarshal(data, &cache)
+         if err == nil && time.Since(cache.Time) < max_age {
+            // drop repos removed since the scan
+            return slices.DeleteFunc(cache.Repos, func(r repo) bool {
+               _, err := os.Stat(r.Dir)
+               return err != nil
+            }), nil
+         }
+      }
+   }
+   repos, err := discover(".", depth, skip)
+   if err != nil {
+      return nil, err
+   }
+   data, err := json.Marshal(repo_cache{time.Now(), repos})
+   if err != nil {
+      return nil, err
+   }
+   err = os.MkdirAll(filepath.Dir(name), os.ModePerm)
+   if err != nil {
+      return nil, err
+   }
+   return repos, os.WriteFile(name, data, 0666)
+}
+
+// depth 1 is the children of root, less than 1 is no limit. repos inside
+// repos are found too, but bare repos are not entered
+func discover(root string, depth int, skip []string) ([]repo, error) {
+   var repos []repo
+   var walk func(string, int) error
+   walk = func(dir string, level int) error {
+      entries, err := os.ReadDir(dir)
+      if err != nil {
+         if errors.Is(err, fs.ErrPermission) {
+            return nil
+         }
+         return err
+      }
+      for _, entry := range entries {
+         // symbolic links are not followed, so there are no loops
+         if !entry.IsDir() {
+            continue
+         }
+         name := entry.Name()
+         if name == ".git" || slices.Contains(skip, name) {
+            continue
+         }
+         path := filepath.Join(dir, name)
+         if is_bare(path) {
+            repos = append(repos, repo{Dir: path, Bare: true})
+            continue
+         }
+         // a .git file is a worktree or submodule
+         _, err := os.Stat(filepath.Join(path, ".git"))
+         if err == nil {
+            repos = append(repos, repo{Dir: path})
+         }
+         if depth < 1 || level < depth {
+            err := walk(path, level+1)
+            if err != nil {
+               return err
+            }
+         }
+      }
+      return nil
+   }
+   return repos, walk(root, 1)
+}
+
+func is_bare(dir string) bool {
+   head, err := os.Stat(filepath.Join(dir, "HEAD"))
+   if err != nil || head.IsDir() {
+      return false
+   }
+   for _, name := range []string{"objects", "refs"} {
+      info, err := os.Stat(filepath.Join(dir, name))
+      if err != nil || !info.IsDir() {
+         return false
+      }
+   }
+   return true
+}
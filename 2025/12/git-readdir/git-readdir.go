@@ -1,34 +1,233 @@
 package main
 
 import (
+   "flag"
    "fmt"
    "log"
    "os"
    "os/exec"
+   "runtime"
+   "strconv"
+   "strings"
+   "sync"
+   "text/tabwriter"
+   "time"
 )
 
 const (
    invert = "\x1b[7m"
-   reset = "\x1b[m"
+   reset  = "\x1b[m"
 )
 
 func main() {
-   dirs, err := os.ReadDir(".")
+   dirty := flag.Bool("d", false, "only show dirty repos")
+   flag.Usage = func() {
+      fmt.Fprintln(flag.CommandLine.Output(), "git-readdir [flags] [git command]")
+      flag.PrintDefaults()
+   }
+   jobs := flag.Int("j", runtime.NumCPU(), "repos at once")
+   depth := flag.Int("depth", 1, "directories down to look, 0 for no limit")
+   skip := flag.String("skip", "node_modules,vendor,.venv", "directories to skip")
+   max_age := flag.Duration("cache", 0, "use repo list found within, 0 to rescan")
+   flag.Parse()
+   repos, err := find_repos(*depth, strings.Split(*skip, ","), *max_age)
    if err != nil {
       log.Fatal(err)
    }
-   for _, dir := range dirs {
-      _, err := os.Stat(dir.Name() + "/.git")
-      if err == nil {
-         cmd := exec.Command("git", "status")
-         cmd.Dir = dir.Name()
-         cmd.Stderr = os.Stderr
-         cmd.Stdout = os.Stdout
-         fmt.Printf("%v Dir %v %v\n", invert, reset, cmd.Dir)
-         err := cmd.Run()
+   if flag.NArg() >= 1 {
+      if !do_action(repos, *jobs, flag.Args()) {
+         os.Exit(1)
+      }
+      return
+   }
+   statuses := make([]repo_status, len(repos))
+   each(repos, *jobs, func(i int, r repo) {
+      statuses[i].repo = r
+      statuses[i].err = statuses[i].New()
+   })
+   tab := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+   var failed []repo_status
+   for _, status := range statuses {
+      if status.err != nil {
+         failed = append(failed, status)
+         continue
+      }
+      if *dirty && !status.dirty() {
+         continue
+      }
+      fmt.Fprintln(tab, &status)
+   }
+   tab.Flush()
+   // errors are per repo, so one bad repo does not stop the rest
+   for _, status := range failed {
+      fmt.Fprintf(os.Stderr, "%v Error %v %v\n", invert, reset, status.Dir)
+      fmt.Fprintln(os.Stderr, status.err)
+   }
+   if len(failed) >= 1 {
+      os.Exit(1)
+   }
+}
+
+// call do for every repo, with at most jobs running at once
+func each(repos []repo, jobs int, do func(int, repo)) {
+   var wait sync.WaitGroup
+   limit := make(chan struct{}, max(jobs, 1))
+   for i, repo := range repos {
+      wait.Add(1)
+      limit <- struct{}{}
+      go func() {
+         defer wait.Done()
+         do(i, repo)
+         <-limit
+      }()
+   }
+   wait.Wait()
+}
+
+type repo_status struct {
+   repo
+   branch    string
+   upstream  bool
+   ahead     int
+   behind    int
+   staged    int
+   modified  int
+   untracked int
+   conflict  int
+   stash     int
+   last      time.Time
+   err       error
+}
+
+func (r *repo_status) New() error {
+   if r.Bare {
+      return r.bare()
+   }
+   text, err := git(r.Dir, "status", "--porcelain=v2", "--branch")
+   if err != nil {
+      return err
+   }
+   for _, line := range strings.Split(text, "\n") {
+      if head, ok := strings.CutPrefix(line, "# branch.head "); ok {
+         r.branch = head
+         continue
+      }
+      if ab, ok := strings.CutPrefix(line, "# branch.ab "); ok {
+         r.upstream = true
+         _, err := fmt.Sscanf(ab, "+%d -%d", &r.ahead, &r.behind)
          if err != nil {
-            log.Fatal(err)
+            return err
+         }
+         continue
+      }
+      // "1 XY ..." or "2 XY ...", where X is the index and Y the work tree
+      if len(line) >= 4 {
+         switch line[0] {
+         case '1', '2':
+            if line[2] != '.' {
+               r.staged++
+            }
+            if line[3] != '.' {
+               r.modified++
+            }
+            continue
          }
       }
+      switch {
+      case strings.HasPrefix(line, "u "):
+         r.conflict++
+      case strings.HasPrefix(line, "? "):
+         r.untracked++
+      }
+   }
+   text, err = git(r.Dir, "stash", "list")
+   if err != nil {
+      return err
+   }
+   if text != "" {
+      r.stash = strings.Count(text, "\n") + 1
+   }
+   return r.last_commit()
+}
+
+// no work tree, so only the branch and last commit
+func (r *repo_status) bare() error {
+   branch, err := git(r.Dir, "symbolic-ref", "--short", "HEAD")
+   if err != nil {
+      return err
+   }
+   r.branch = branch
+   return r.last_commit()
+}
+
+func (r *repo_status) last_commit() error {
+   // fails if there are no commits yet
+   text, err := git(r.Dir, "log", "-1", "--format=%ct")
+   if err == nil {
+      unix, err := strconv.ParseInt(text, 10, 64)
+      if err != nil {
+         return err
+      }
+      r.last = time.Unix(unix, 0)
+   }
+   return nil
+}
+
+func (r *repo_status) dirty() bool {
+   return r.staged+r.modified+r.untracked+r.conflict+r.ahead >= 1
+}
+
+// tab separated for tabwriter
+func (r *repo_status) String() string {
+   var data strings.Builder
+   data.WriteString(r.Dir)
+   data.WriteByte('\t')
+   data.WriteString(r.branch)
+   data.WriteByte('\t')
+   if r.Bare {
+      data.WriteString("bare\t\t\t")
+      data.WriteString(age(r.last))
+      return data.String()
+   }
+   if r.upstream {
+      fmt.Fprintf(&data, "ahead:%v behind:%v", r.ahead, r.behind)
+   } else {
+      data.WriteString("no upstream")
+   }
+   fmt.Fprintf(
+      &data, "\tstaged:%v modified:%v untracked:%v",
+      r.staged, r.modified, r.untracked,
+   )
+   if r.conflict >= 1 {
+      fmt.Fprintf(&data, " conflict:%v", r.conflict)
+   }
+   fmt.Fprintf(&data, "\tstash:%v\t", r.stash)
+   data.WriteString(age(r.last))
+   return data.String()
+}
+
+func age(last time.Time) string {
+   if last.IsZero() {
+      return "no commits"
+   }
+   since := time.Since(last)
+   switch {
+   case since < time.Hour:
+      return fmt.Sprint(int(since.Minutes()), "m")
+   case since < 24*time.Hour:
+      return fmt.Sprint(int(since.Hours()), "h")
+   }
+   return fmt.Sprint(int(since.Hours()/24), "d")
+}
+
+func git(dir string, arg ...string) (string, error) {
+   cmd := exec.Command("git", arg...)
+   cmd.Dir = dir
+   var stderr strings.Builder
+   cmd.Stderr = &stderr
+   text, err := cmd.Output()
+   if err != nil {
+      return "", fmt.Errorf("%v %v", cmd.Args, strings.TrimSpace(stderr.String()))
    }
+   return strings.TrimSpace(string(text)), nil
 }
@@ -0,0 +1,176 @@
+package main
+
+import (
+   "bytes"
+   "fmt"
+   "sort"
+   "strings"
+)
+
+type edit struct {
+   op   byte
+   line string
+}
+
+// patience diff: lines found once on each side anchor the diff, then the
+// gaps between anchors are diffed the same way
+func diff_lines(x, y []string) []edit {
+   var edits []edit
+   var prefix int
+   for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+      edits = append(edits, edit{' ', x[prefix]})
+      prefix++
+   }
+   x, y = x[prefix:], y[prefix:]
+   var suffix int
+   for suffix < len(x) && suffix < len(y) &&
+      x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+      suffix++
+   }
+   common := x[len(x)-suffix:]
+   x, y = x[:len(x)-suffix], y[:len(y)-suffix]
+   anchors := unique_anchors(x, y)
+   if len(anchors) == 0 {
+      for _, line := range x {
+         edits = append(edits, edit{'-', line})
+      }
+      for _, line := range y {
+         edits = append(edits, edit{'+', line})
+      }
+   } else {
+      var i, j int
+      for _, anchor := range anchors {
+         edits = append(edits, diff_lines(x[i:anchor[0]], y[j:anchor[1]])...)
+         edits = append(edits, edit{' ', x[anchor[0]]})
+         i, j = anchor[0]+1, anchor[1]+1
+      }
+      edits = append(edits, diff_lines(x[i:], y[j:])...)
+   }
+   for _, line := range common {
+      edits = append(edits, edit{' ', line})
+   }
+   return edits
+}
+
+// longest increasing run of lines that appear once in x and once in y
+func unique_anchors(x, y []string) [][2]int {
+   type count struct {
+      x, y, j int
+   }
+   counts := map[string]*count{}
+   for _, line := range x {
+      c, ok := counts[line]
+      if !ok {
+         c = &count{}
+         counts[line] = c
+      }
+      c.x++
+   }
+   for j, line := range y {
+      c, ok := counts[line]
+      if ok {
+         c.y++
+         c.j = j
+      }
+   }
+   var pairs [][2]int
+   for i, line := range x {
+      c := counts[line]
+      if c.x == 1 && c.y == 1 {
+         pairs = append(pairs, [2]int{i, c.j})
+      }
+   }
+   // patience sorting
+   var tails []int
+   back := make([]int, len(pairs))
+   for k, pair := range pairs {
+      pile := sort.Search(len(tails), func(t int) bool {
+         return pairs[tails[t]][1] > pair[1]
+      })
+      back[k] = -1
+      if pile >= 1 {
+         back[k] = tails[pile-1]
+      }
+      if pile == len(tails) {
+         tails = append(tails, k)
+      } else {
+         tails[pile] = k
+      }
+   }
+   if len(tails) == 0 {
+      return nil
+   }
+   anchors := make([][2]int, len(tails))
+   for k, i := tails[len(tails)-1], len(tails)-1; k >= 0; k, i = back[k], i-1 {
+      anchors[i] = pairs[k]
+   }
+   return anchors
+}
+
+func split_lines(data []byte) []string {
+   lines := strings.SplitAfter(string(data), "\n")
+   if lines[len(lines)-1] == "" {
+      lines = lines[:len(lines)-1]
+   }
+   return lines
+}
+
+const context = 3
+
+// same layout as diff -u
+func unified(name string, a, b []byte) []byte {
+   edits := diff_lines(split_lines(a), split_lines(b))
+   // line number before each edit
+   before := make([]int, len(edits)+1)
+   after := make([]int, len(edits)+1)
+   for i, e := range edits {
+      before[i+1], after[i+1] = before[i], after[i]
+      if e.op != '+' {
+         before[i+1]++
+      }
+      if e.op != '-' {
+         after[i+1]++
+      }
+   }
+   var data bytes.Buffer
+   fmt.Fprintf(&data, "--- %v.orig\n+++ %v\n", name, name)
+   for i := 0; i < len(edits); {
+      if edits[i].op == ' ' {
+         i++
+         continue
+      }
+      // join changes closer than two contexts
+      last := i
+      for k := i; k < len(edits) && k-last <= 2*context; k++ {
+         if edits[k].op != ' ' {
+            last = k
+         }
+      }
+      start := max(i-context, 0)
+      end := min(last+context+1, len(edits))
+      fmt.Fprintf(
+         &data, "@@ -%v +%v @@\n",
+         hunk_range(before[start], before[end]),
+         hunk_range(after[start], after[end]),
+      )
+      for _, e := range edits[start:end] {
+         data.WriteByte(e.op)
+         data.WriteString(e.line)
+         if !strings.HasSuffix(e.line, "\n") {
+            data.WriteString("\n\\ No newline at end of file\n")
+         }
+      }
+      i = end
+   }
+   return data.Bytes()
+}
+
+func hunk_range(start, end int) string {
+   if end-start == 1 {
+      return fmt.Sprint(start + 1)
+   }
+   if end == start {
+      return fmt.Sprintf("%v,0", start)
+   }
+   return fmt.Sprintf("%v,%v", start+1, end-start)
+}
@@ -2,45 +2,353 @@ package main
 
 import (
    "bytes"
+   "errors"
+   "flag"
+   "fmt"
+   "go/ast"
+   "go/format"
+   "go/parser"
+   "go/scanner"
+   "go/token"
+   "io"
    "io/fs"
    "log"
    "os"
-   "os/exec"
    "path/filepath"
+   "runtime"
+   "strings"
+   "sync"
 )
 
-func walk_dir(path string, _ fs.DirEntry, err error) error {
+// gofmt, then the leading tabs of each line become spaces. lines that start
+// inside a raw string are content, so they are left alone
+func space(src []byte, width int) ([]byte, error) {
+   src, err := format.Source(src)
+   if err != nil {
+      return nil, err
+   }
+   return indent(src, func(line []byte) []byte {
+      tabs := len(line) - len(bytes.TrimLeft(line, "\t"))
+      return append(bytes.Repeat([]byte{' '}, tabs*width), line[tabs:]...)
+   }), nil
+}
+
+// the inverse of space. gofmt puts back tabs for code, as it reads the syntax
+// tree, but the inside of a block comment is text, so each leading run of
+// width spaces becomes a tab first
+func tab(src []byte, width int) ([]byte, error) {
+   if width >= 1 {
+      run := bytes.Repeat([]byte{' '}, width)
+      src = indent(src, func(line []byte) []byte {
+         var tabs int
+         for bytes.HasPrefix(line, run) {
+            line = line[width:]
+            tabs++
+         }
+         return append(bytes.Repeat([]byte{'\t'}, tabs), line...)
+      })
+   }
+   return format.Source(src)
+}
+
+// change each line that does not start inside a raw string
+func indent(src []byte, change func([]byte) []byte) []byte {
+   raw := raw_strings(src)
+   var data bytes.Buffer
+   for offset := 0; offset < len(src); {
+      end := bytes.IndexByte(src[offset:], '\n') + 1
+      if end == 0 {
+         end = len(src)
+      } else {
+         end += offset
+      }
+      line := src[offset:end]
+      if !raw.contains(offset) {
+         line = change(line)
+      }
+      data.Write(line)
+      offset = end
+   }
+   return data.Bytes()
+}
+
+type spans [][2]int
+
+func (s spans) contains(offset int) bool {
+   for _, span := range s {
+      if offset > span[0] && offset < span[1] {
+         return true
+      }
+   }
+   return false
+}
+
+// the scanner drops carriage returns from raw strings, so the end is found
+// from the source instead of the literal
+func raw_strings(src []byte) spans {
+   file := token.NewFileSet().AddFile("", -1, len(src))
+   var scan scanner.Scanner
+   scan.Init(file, src, nil, 0)
+   var raw spans
+   for {
+      pos, tok, lit := scan.Scan()
+      if tok == token.EOF {
+         return raw
+      }
+      if tok == token.STRING && lit[0] == '`' {
+         start := file.Offset(pos)
+         end := bytes.IndexByte(src[start+1:], '`') + start + 2
+         raw = append(raw, [2]int{start, end})
+      }
+   }
+}
+
+type command struct {
+   list    bool
+   diff    bool
+   check   bool
+   width   int
+   reverse bool
+   filter  bool
+   all     bool
+   dirty   bool
+   bad     bool
+}
+
+func (c *command) convert(src []byte) ([]byte, error) {
+   if c.reverse {
+      return tab(src, c.width)
+   }
+   src, err := format.Source(src)
+   if err != nil {
+      return nil, err
+   }
+   data, err := space(src, c.width)
+   if err != nil {
+      return nil, err
+   }
+   // a comment line indented with a tab then spaces reads back as more tabs,
+   // so -r would not give the same file
+   back, err := tab(data, c.width)
+   if err != nil {
+      return nil, err
+   }
+   if !bytes.Equal(back, src) {
+      return nil, errors.New("spaces in a block comment would not convert back")
+   }
+   return data, nil
+}
+
+// a git filter must not fail, so bad input goes through as is
+func (c *command) do_filter() error {
+   src, err := io.ReadAll(os.Stdin)
    if err != nil {
       return err
    }
-   if filepath.Ext(path) != ".go" {
+   data, err := c.convert(src)
+   if err != nil {
+      log.Print(err)
+      data = src
+   }
+   _, err = os.Stdout.Write(data)
+   return err
+}
+
+// files under root, or root itself if it is a file
+func (c *command) files(root string) ([]string, error) {
+   info, err := os.Stat(root)
+   if err != nil {
+      return nil, err
+   }
+   if !info.IsDir() {
+      return []string{root}, nil
+   }
+   // WalkDir gives cleaned paths, so "./cmd" or "cmd/" would miss in rules
+   root = filepath.Clean(root)
+   // rules are matched with absolute paths, as they can come from above root
+   abs, err := filepath.Abs(root)
+   if err != nil {
+      return nil, err
+   }
+   top, err := parents(abs)
+   if err != nil {
+      return nil, err
+   }
+   // rules for each directory, parents first
+   rules := map[string]ignore{filepath.Dir(root): top}
+   var files []string
+   err = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+      if err != nil {
+         return err
+      }
+      if c.all {
+         if !entry.IsDir() && filepath.Ext(path) == ".go" {
+            files = append(files, path)
+         }
+         return nil
+      }
+      rel, err := filepath.Rel(root, path)
+      if err != nil {
+         return err
+      }
+      full := filepath.Join(abs, rel)
+      parent := rules[filepath.Dir(path)]
+      if entry.IsDir() {
+         if path != root {
+            if skip_name(entry.Name()) || parent.match(full, true) {
+               return filepath.SkipDir
+            }
+         }
+         rules[path], err = parent.read(full)
+         return err
+      }
+      if filepath.Ext(path) != ".go" {
+         return nil
+      }
+      if skip_name(entry.Name()) || parent.match(full, false) {
+         return nil
+      }
+      files = append(files, path)
       return nil
+   })
+   return files, err
+}
+
+// same as the go command, plus vendor
+func skip_name(name string) bool {
+   switch name {
+   case "testdata", "vendor":
+      return true
+   }
+   return strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")
+}
+
+type result struct {
+   out   []byte
+   dirty bool
+   err   error
+}
+
+func (c *command) file(path string) result {
+   var r result
+   src, err := os.ReadFile(path)
+   if err != nil {
+      r.err = err
+      return r
+   }
+   if !c.all && generated(path, src) {
+      return r
+   }
+   data, err := c.convert(src)
+   if err != nil {
+      r.err = err
+      return r
+   }
+   if bytes.Equal(src, data) {
+      return r
+   }
+   r.dirty = true
+   if c.list || c.check {
+      r.out = fmt.Appendln(r.out, path)
+   }
+   if c.diff {
+      r.out = append(r.out, unified(path, src, data)...)
+   }
+   if c.list || c.diff || c.check {
+      return r
    }
    log.Print(path)
-   data, err := os.ReadFile(path)
+   info, err := os.Stat(path)
    if err != nil {
-      return err
+      r.err = err
+      return r
    }
-   data = bytes.ReplaceAll(
-      data, []byte{'\t'}, []byte("   "),
+   r.err = os.WriteFile(path, data, info.Mode().Perm())
+   return r
+}
+
+// "// Code generated ... DO NOT EDIT." before the package clause
+func generated(path string, src []byte) bool {
+   file, err := parser.ParseFile(
+      token.NewFileSet(), path, src, parser.PackageClauseOnly|parser.ParseComments,
    )
-   return os.WriteFile(path, data, os.ModePerm)
+   if err != nil {
+      return false
+   }
+   return ast.IsGenerated(file)
 }
 
-func run(name string, arg ...string) error {
-   command := exec.Command(name, arg...)
-   log.Println(command.Args)
-   return command.Run()
+// results are printed in walk order
+func (c *command) run(roots []string) error {
+   var files []string
+   for _, root := range roots {
+      files2, err := c.files(root)
+      if err != nil {
+         return err
+      }
+      files = append(files, files2...)
+   }
+   results := make([]result, len(files))
+   var wait sync.WaitGroup
+   limit := make(chan struct{}, runtime.NumCPU())
+   for i, path := range files {
+      wait.Add(1)
+      limit <- struct{}{}
+      go func() {
+         defer wait.Done()
+         results[i] = c.file(path)
+         <-limit
+      }()
+   }
+   wait.Wait()
+   for i, r := range results {
+      os.Stdout.Write(r.out)
+      if r.dirty {
+         c.dirty = true
+      }
+      if r.err != nil {
+         // keep going, like gofmt
+         log.Print(files[i], ": ", r.err)
+         c.bad = true
+      }
+   }
+   return nil
 }
 
 func main() {
    log.SetFlags(log.Ltime)
-   err := run("gofmt", "-w", ".")
-   if err != nil {
-      log.Fatal(err)
+   var set command
+   flag.BoolVar(&set.list, "l", false, "list files that would change")
+   flag.BoolVar(&set.diff, "d", false, "show diff instead of writing")
+   flag.BoolVar(&set.check, "c", false, "list files that would change and exit 1")
+   flag.IntVar(&set.width, "i", 3, "spaces per indent")
+   flag.BoolVar(&set.reverse, "r", false, "indent with tabs, like gofmt")
+   flag.BoolVar(&set.filter, "f", false, "filter stdin to stdout")
+   flag.BoolVar(&set.all, "a", false, "include ignored, vendor and generated files")
+   flag.Usage = func() {
+      fmt.Fprintln(flag.CommandLine.Output(), "go-space [flags] [path...]")
+      flag.PrintDefaults()
    }
-   err = filepath.WalkDir(".", walk_dir)
+   flag.Parse()
+   if set.width < 0 {
+      log.Fatal("-i ", set.width)
+   }
+   if set.filter {
+      err := set.do_filter()
+      if err != nil {
+         log.Fatal(err)
+      }
+      return
+   }
+   roots := flag.Args()
+   if len(roots) == 0 {
+      roots = []string{"."}
+   }
+   err := set.run(roots)
    if err != nil {
       log.Fatal(err)
    }
+   if set.bad || set.check && set.dirty {
+      os.Exit(1)
+   }
 }
@@ -0,0 +1,131 @@
+package main
+
+import (
+   "bufio"
+   "errors"
+   "io/fs"
+   "os"
+   "path"
+   "path/filepath"
+   "slices"
+   "strings"
+)
+
+// .gitignore files above dir count too, up to the top of the repo
+func parents(dir string) (ignore, error) {
+   var dirs []string
+   for {
+      _, err := os.Stat(filepath.Join(dir, ".git"))
+      if err == nil {
+         break
+      }
+      up := filepath.Dir(dir)
+      // not in a repo
+      if up == dir {
+         return nil, nil
+      }
+      dir = up
+      dirs = append(dirs, dir)
+   }
+   var rules ignore
+   for _, dir := range slices.Backward(dirs) {
+      var err error
+      rules, err = rules.read(dir)
+      if err != nil {
+         return nil, err
+      }
+   }
+   return rules, nil
+}
+
+// one line of a .gitignore
+type ignore_rule struct {
+   base     string
+   pattern  string
+   negate   bool
+   dir_only bool
+   anchored bool
+}
+
+type ignore []ignore_rule
+
+// the rules of dir/.gitignore come after the parent rules, so they win
+func (i ignore) read(dir string) (ignore, error) {
+   file, err := os.Open(filepath.Join(dir, ".gitignore"))
+   if err != nil {
+      if errors.Is(err, fs.ErrNotExist) {
+         return i, nil
+      }
+      return nil, err
+   }
+   defer file.Close()
+   rules := i[:len(i):len(i)]
+   scan := bufio.NewScanner(file)
+   for scan.Scan() {
+      line := strings.TrimRight(scan.Text(), " \r")
+      if line == "" || strings.HasPrefix(line, "#") {
+         continue
+      }
+      rule := ignore_rule{base: dir}
+      line, rule.negate = strings.CutPrefix(line, "!")
+      line = strings.TrimPrefix(line, `\`)
+      line, rule.dir_only = strings.CutSuffix(line, "/")
+      // a slash at the start or middle ties the pattern to this directory
+      rule.anchored = strings.Contains(line, "/")
+      rule.pattern = strings.TrimPrefix(line, "/")
+      rules = append(rules, rule)
+   }
+   return rules, scan.Err()
+}
+
+// the last matching rule decides
+func (i ignore) match(name string, dir bool) bool {
+   var ignored bool
+   for _, rule := range i {
+      if rule.dir_only && !dir {
+         continue
+      }
+      rel, err := filepath.Rel(rule.base, name)
+      if err != nil || strings.HasPrefix(rel, "..") {
+         continue
+      }
+      rel = filepath.ToSlash(rel)
+      var ok bool
+      if rule.anchored {
+         ok = glob(rule.pattern, rel)
+      } else {
+         ok, _ = path.Match(rule.pattern, path.Base(rel))
+      }
+      if ok {
+         ignored = !rule.negate
+      }
+   }
+   return ignored
+}
+
+// path.Match, where a "**" element matches any number of elements
+func glob(pattern, name string) bool {
+   return glob_elements(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func glob_elements(pattern, name []string) bool {
+   for len(pattern) >= 1 {
+      if pattern[0] == "**" {
+         for i := range len(name) + 1 {
+            if glob_elements(pattern[1:], name[i:]) {
+               return true
+            }
+         }
+         return false
+      }
+      if len(name) == 0 {
+         return false
+      }
+      ok, _ := path.Match(pattern[0], name[0])
+      if !ok {
+         return false
+      }
+      pattern, name = pattern[1:], name[1:]
+   }
+   return len(name) == 0
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+   "fmt"
+   "log"
+   "slices"
+   "strings"
+)
+
+// estimateTokens uses the usual rule of thumb of about four characters per
+// token. It is only meant to be close enough to plan around a context window.
+func estimateTokens(text string) int {
+   return (len(text) + 3) / 4
+}
+
+// minKeptTokens is the smallest useful piece of a truncated file. A file that
+// would be cut below this is dropped instead.
+const minKeptTokens = 256
+
+// applyBudget shrinks the bundle until the estimate fits in budget tokens.
+// The largest files go first: each one is dropped, unless cutting its tail
+// is enough to fit, in which case it is truncated at a line boundary.
+func applyBudget(files []FileData, budget int) []FileData {
+   total := 0
+   for _, file := range files {
+      total += estimateTokens(file.Data)
+   }
+   excess := total - budget
+   if budget <= 0 || excess <= 0 {
+      return files
+   }
+
+   // Work on indexes, so the bundle keeps its original order.
+   order := make([]int, len(files))
+   for i := range order {
+      order[i] = i
+   }
+   slices.SortStableFunc(order, func(a, b int) int {
+      return estimateTokens(files[b].Data) - estimateTokens(files[a].Data)
+   })
+
+   dropped := make(map[int]bool)
+   for _, i := range order {
+      if excess <= 0 {
+         break
+      }
+      tokens := estimateTokens(files[i].Data)
+      keep := tokens - excess
+      if keep >= minKeptTokens {
+         files[i].Data = truncate(files[i].Data, keep)
+         log.Printf("Budget: truncated %s from %d to about %d tokens", files[i].Name, tokens, keep)
+         excess = 0
+         break
+      }
+      dropped[i] = true
+      excess -= tokens
+      log.Printf("Budget: dropped %s (%d tokens)", files[i].Name, tokens)
+   }
+
+   var kept []FileData
+   for i, file := range files {
+      if !dropped[i] {
+         kept = append(kept, file)
+      }
+   }
+   return kept
+}
+
+// truncate keeps roughly the first tokens of text, cut at the end of a line,
+// and says how much was left out so the reader knows the file is partial.
+func truncate(text string, tokens int) string {
+   // Leave room for the note at the end.
+   limit := tokens*4 - 64
+   if limit <= 0 || limit >= len(text) {
+      return text
+   }
+   cut := strings.LastIndexByte(text[:limit], '\n')
+   if cut <= 0 {
+      cut = limit
+   }
+   omitted := estimateTokens(text[cut:])
+   return text[:cut] + fmt.Sprintf("\n[... truncated, about %d tokens omitted ...]\n", omitted)
+}
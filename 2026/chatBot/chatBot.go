@@ -1,12 +1,17 @@
 package main
 
 import (
+   "bytes"
    "encoding/json"
    "flag"
+   "io/fs"
    "log"
+   "net/http"
    "os"
    "path/filepath"
+   "slices"
    "strings"
+   "unicode/utf8"
 )
 
 // FileData struct uses the clear "name" and "data" keys.
@@ -15,9 +20,27 @@ type FileData struct {
    Data string `json:"data"`
 }
 
+// subcommands are run as "chatBot <name> [flags]". Without one, chatBot
+// bundles -dir as before.
+var subcommands = map[string]func(args []string){
+   "send":   runSend,
+   "unpack": runUnpack,
+}
+
 func main() {
-   // 1. Define and parse the required -dir flag.
+   if len(os.Args) > 1 {
+      if run, ok := subcommands[os.Args[1]]; ok {
+         run(os.Args[2:])
+         return
+      }
+   }
+
+   // 1. Define and parse the flags. Only -dir is required.
    inputDir := flag.String("dir", "", "The path to the input directory (required).")
+   extList := flag.String("ext", "", "Comma-separated extensions to include, such as .go,.md (default all).")
+   outputPath := flag.String("o", "", `Output file, or "-" for stdout (default "combined" plus the format's extension).`)
+   formatName := flag.String("format", "json", "Output format: json, jsonl, markdown or xml.")
+   budget := flag.Int("budget", 0, "Approximate token limit; the largest files are dropped or truncated to fit (0 means no limit).")
    flag.Parse()
 
    if *inputDir == "" {
@@ -26,6 +49,13 @@ func main() {
       os.Exit(1)
    }
 
+   format, ok := outputFormats[*formatName]
+   if !ok {
+      log.Printf("Error: Unknown format '%s'.", *formatName)
+      flag.Usage()
+      os.Exit(1)
+   }
+
    log.Printf("Target directory is: %s", *inputDir)
 
    // Validate that the provided path is a valid directory.
@@ -37,8 +67,8 @@ func main() {
       log.Fatalf("Error: The path '%s' is not a directory.", *inputDir)
    }
 
-   // 2. Find all processable files in that directory.
-   sourceFiles, err := findSourceFiles(*inputDir)
+   // 2. Find all processable files under that directory, honouring .gitignore.
+   sourceFiles, err := findSourceFiles(*inputDir, parseExtensions(*extList))
    if err != nil {
       log.Fatalf("Error finding files in '%s': %v", *inputDir, err)
    }
@@ -49,29 +79,58 @@ func main() {
 
    log.Printf("Found %d files in '%s' to process...", len(sourceFiles), *inputDir)
 
-   // 3. Read the content of each file.
+   // 3. Read the content of each file, skipping anything that is not text.
    var fileDataList []FileData
+   totalTokens := 0
    for _, filename := range sourceFiles {
-      fullPath := filepath.Join(*inputDir, filename)
+      fullPath := filepath.Join(*inputDir, filepath.FromSlash(filename))
       content, err := os.ReadFile(fullPath)
       if err != nil {
          log.Fatalf("Error reading file %s: %v", fullPath, err)
       }
+      if isBinary(content) {
+         log.Printf("Skipping binary file %s", filename)
+         continue
+      }
 
       contentString := string(content)
       cleanedContent := strings.ReplaceAll(contentString, "\r", "")
+      tokens := estimateTokens(cleanedContent)
+      totalTokens += tokens
+      log.Printf("%8d tokens  %s", tokens, filename)
       fileDataList = append(fileDataList, FileData{Name: filename, Data: cleanedContent})
    }
+   log.Printf("%8d tokens  total (estimated)", totalTokens)
+
+   // 3b. Shrink the bundle to the token budget, if one was given.
+   if *budget > 0 && totalTokens > *budget {
+      fileDataList = applyBudget(fileDataList, *budget)
+      totalTokens = 0
+      for _, file := range fileDataList {
+         totalTokens += estimateTokens(file.Data)
+      }
+      log.Printf("%8d tokens  total after applying the budget of %d", totalTokens, *budget)
+   }
 
-   // 4. Generate the compact JSON output.
-   output, err := generateJSON(fileDataList)
+   // 4. Generate the output in the chosen format.
+   output, err := format.generate(fileDataList)
    if err != nil {
-      log.Fatalf("Error generating JSON output: %v", err)
+      log.Fatalf("Error generating %s output: %v", *formatName, err)
    }
 
-   // 5. --- THIS IS THE CORRECTED LINE ---
-   // Write the output file to the CURRENT WORKING DIRECTORY, not the input directory.
-   outputFilename := "combined.json"
+   // 5. Write to stdout, or to a file in the CURRENT WORKING DIRECTORY by
+   // default, not the input directory.
+   if *outputPath == "-" {
+      _, err = os.Stdout.WriteString(output)
+      if err != nil {
+         log.Fatalf("Error writing to stdout: %v", err)
+      }
+      return
+   }
+   outputFilename := *outputPath
+   if outputFilename == "" {
+      outputFilename = "combined" + format.extension
+   }
    err = os.WriteFile(outputFilename, []byte(output), 0644)
    if err != nil {
       log.Fatalf("Error writing to file %s: %v", outputFilename, err)
@@ -80,20 +139,90 @@ func main() {
    log.Printf("Success! Output has been saved to %s", outputFilename)
 }
 
-// findSourceFiles now correctly uses os.ReadDir.
-func findSourceFiles(targetDir string) ([]string, error) {
-   entries, err := os.ReadDir(targetDir)
+// findSourceFiles walks targetDir recursively and returns the file paths
+// relative to it, with forward slashes. Paths matched by a .gitignore (in
+// targetDir, below it, or above it up to the repository root) are skipped, as
+// is the .git directory itself. If extensions is not empty, only files with
+// one of those extensions are returned.
+func findSourceFiles(targetDir string, extensions []string) ([]string, error) {
+   root, err := filepath.Abs(targetDir)
    if err != nil {
       return nil, err
    }
+   parentRules, err := parentIgnoreRules(root)
+   if err != nil {
+      return nil, err
+   }
+
+   // Every directory gets its parent's rules plus its own .gitignore.
+   rulesByDir := map[string]ignoreRules{filepath.Dir(root): parentRules}
 
    var files []string
-   for _, entry := range entries {
-      if !entry.IsDir() {
-         files = append(files, entry.Name())
+   err = filepath.WalkDir(root, func(fullPath string, entry fs.DirEntry, err error) error {
+      if err != nil {
+         return err
+      }
+      rules := rulesByDir[filepath.Dir(fullPath)]
+      if entry.IsDir() {
+         if entry.Name() == ".git" || fullPath != root && rules.match(fullPath, true) {
+            return filepath.SkipDir
+         }
+         rulesByDir[fullPath], err = rules.read(fullPath)
+         return err
+      }
+      if !entry.Type().IsRegular() || rules.match(fullPath, false) {
+         return nil
+      }
+      if len(extensions) > 0 && !slices.Contains(extensions, strings.ToLower(filepath.Ext(fullPath))) {
+         return nil
+      }
+      rel, err := filepath.Rel(root, fullPath)
+      if err != nil {
+         return err
+      }
+      files = append(files, filepath.ToSlash(rel))
+      return nil
+   })
+   return files, err
+}
+
+// parseExtensions turns "go, .MD" into [".go" ".md"].
+func parseExtensions(list string) []string {
+   var extensions []string
+   for _, ext := range strings.Split(list, ",") {
+      ext = strings.ToLower(strings.TrimSpace(ext))
+      if ext == "" {
+         continue
+      }
+      if !strings.HasPrefix(ext, ".") {
+         ext = "." + ext
       }
+      extensions = append(extensions, ext)
+   }
+   return extensions
+}
+
+// isBinary sniffs the start of the content the way git and most editors do:
+// a NUL byte or invalid UTF-8 means binary, and so does anything
+// http.DetectContentType recognises as a non-text format such as an image or
+// an archive.
+func isBinary(content []byte) bool {
+   sample := content
+   if len(sample) > 8000 {
+      sample = sample[:8000]
+      // The cut may split a character, so drop an incomplete one at the end.
+      for i := 0; i < utf8.UTFMax-1 && !utf8.Valid(sample); i++ {
+         sample = sample[:len(sample)-1]
+      }
+   }
+   if bytes.IndexByte(sample, 0) >= 0 {
+      return true
+   }
+   if !utf8.Valid(sample) {
+      return true
    }
-   return files, nil
+   contentType := http.DetectContentType(sample)
+   return !strings.HasPrefix(contentType, "text/") && contentType != "application/octet-stream"
 }
 
 // generateJSON converts the file data into a compact, single-line JSON string.
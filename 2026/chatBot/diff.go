@@ -0,0 +1,188 @@
+// The patience diff here is modelled on 2025/12/go-space/diff.go, but it is
+// written for this module and maintained separately.
+
+package main
+
+import (
+   "fmt"
+   "sort"
+   "strings"
+)
+
+// diffEdit is one line of a diff: ' ' kept, '-' removed or '+' added.
+type diffEdit struct {
+   op   byte
+   line string
+}
+
+// diffLines is a patience diff. Lines that appear exactly once on each side
+// anchor the result, and the gaps between anchors are diffed the same way.
+// It keeps moved functions and blocks readable where a plain LCS does not.
+func diffLines(oldLines, newLines []string) []diffEdit {
+   var edits []diffEdit
+   prefix := 0
+   for prefix < len(oldLines) && prefix < len(newLines) && oldLines[prefix] == newLines[prefix] {
+      edits = append(edits, diffEdit{' ', oldLines[prefix]})
+      prefix++
+   }
+   oldLines, newLines = oldLines[prefix:], newLines[prefix:]
+
+   suffix := 0
+   for suffix < len(oldLines) && suffix < len(newLines) &&
+      oldLines[len(oldLines)-1-suffix] == newLines[len(newLines)-1-suffix] {
+      suffix++
+   }
+   common := oldLines[len(oldLines)-suffix:]
+   oldLines, newLines = oldLines[:len(oldLines)-suffix], newLines[:len(newLines)-suffix]
+
+   anchors := uniqueAnchors(oldLines, newLines)
+   if len(anchors) == 0 {
+      for _, line := range oldLines {
+         edits = append(edits, diffEdit{'-', line})
+      }
+      for _, line := range newLines {
+         edits = append(edits, diffEdit{'+', line})
+      }
+   } else {
+      i, j := 0, 0
+      for _, anchor := range anchors {
+         edits = append(edits, diffLines(oldLines[i:anchor[0]], newLines[j:anchor[1]])...)
+         edits = append(edits, diffEdit{' ', oldLines[anchor[0]]})
+         i, j = anchor[0]+1, anchor[1]+1
+      }
+      edits = append(edits, diffLines(oldLines[i:], newLines[j:])...)
+   }
+
+   for _, line := range common {
+      edits = append(edits, diffEdit{' ', line})
+   }
+   return edits
+}
+
+// uniqueAnchors returns the longest increasing run of line pairs that appear
+// once in oldLines and once in newLines, found by patience sorting.
+func uniqueAnchors(oldLines, newLines []string) [][2]int {
+   type lineCount struct {
+      old, new, newIndex int
+   }
+   counts := make(map[string]*lineCount)
+   for _, line := range oldLines {
+      count, ok := counts[line]
+      if !ok {
+         count = &lineCount{}
+         counts[line] = count
+      }
+      count.old++
+   }
+   for j, line := range newLines {
+      if count, ok := counts[line]; ok {
+         count.new++
+         count.newIndex = j
+      }
+   }
+
+   var pairs [][2]int
+   for i, line := range oldLines {
+      count := counts[line]
+      if count.old == 1 && count.new == 1 {
+         pairs = append(pairs, [2]int{i, count.newIndex})
+      }
+   }
+
+   var tails []int
+   back := make([]int, len(pairs))
+   for k, pair := range pairs {
+      pile := sort.Search(len(tails), func(t int) bool {
+         return pairs[tails[t]][1] > pair[1]
+      })
+      back[k] = -1
+      if pile > 0 {
+         back[k] = tails[pile-1]
+      }
+      if pile == len(tails) {
+         tails = append(tails, k)
+      } else {
+         tails[pile] = k
+      }
+   }
+   if len(tails) == 0 {
+      return nil
+   }
+   anchors := make([][2]int, len(tails))
+   for k, i := tails[len(tails)-1], len(tails)-1; k >= 0; k, i = back[k], i-1 {
+      anchors[i] = pairs[k]
+   }
+   return anchors
+}
+
+// splitLines splits text into lines that keep their "\n".
+func splitLines(text string) []string {
+   lines := strings.SplitAfter(text, "\n")
+   if lines[len(lines)-1] == "" {
+      lines = lines[:len(lines)-1]
+   }
+   return lines
+}
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// unifiedDiff formats the change from oldText to newText the way diff -u does.
+func unifiedDiff(name, oldText, newText string) string {
+   edits := diffLines(splitLines(oldText), splitLines(newText))
+
+   // The line numbers on each side before every edit.
+   before := make([]int, len(edits)+1)
+   after := make([]int, len(edits)+1)
+   for i, edit := range edits {
+      before[i+1], after[i+1] = before[i], after[i]
+      if edit.op != '+' {
+         before[i+1]++
+      }
+      if edit.op != '-' {
+         after[i+1]++
+      }
+   }
+
+   var builder strings.Builder
+   fmt.Fprintf(&builder, "--- a/%s\n+++ b/%s\n", name, name)
+   for i := 0; i < len(edits); {
+      if edits[i].op == ' ' {
+         i++
+         continue
+      }
+      // Changes closer than two contexts apart share a hunk.
+      last := i
+      for k := i; k < len(edits) && k-last <= 2*diffContext; k++ {
+         if edits[k].op != ' ' {
+            last = k
+         }
+      }
+      start := max(i-diffContext, 0)
+      end := min(last+diffContext+1, len(edits))
+      fmt.Fprintf(&builder, "@@ -%s +%s @@\n",
+         hunkRange(before[start], before[end]),
+         hunkRange(after[start], after[end]),
+      )
+      for _, edit := range edits[start:end] {
+         builder.WriteByte(edit.op)
+         builder.WriteString(edit.line)
+         if !strings.HasSuffix(edit.line, "\n") {
+            builder.WriteString("\n\\ No newline at end of file\n")
+         }
+      }
+      i = end
+   }
+   return builder.String()
+}
+
+// hunkRange formats one side of a hunk header, such as "4,7" or "0,0".
+func hunkRange(start, end int) string {
+   switch end - start {
+   case 0:
+      return fmt.Sprintf("%d,0", start)
+   case 1:
+      return fmt.Sprint(start + 1)
+   }
+   return fmt.Sprintf("%d,%d", start+1, end-start)
+}
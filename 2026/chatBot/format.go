@@ -0,0 +1,134 @@
+package main
+
+import (
+   "encoding/json"
+   "fmt"
+   "html"
+   "path"
+   "strings"
+)
+
+// outputFormat pairs a generator with the extension of its default file name.
+type outputFormat struct {
+   extension string
+   generate  func([]FileData) (string, error)
+}
+
+// outputFormats lists every value accepted by -format.
+var outputFormats = map[string]outputFormat{
+   "json":     {".json", generateJSON},
+   "jsonl":    {".jsonl", generateJSONLines},
+   "markdown": {".md", generateMarkdown},
+   "xml":      {".xml", generateXML},
+}
+
+// generateJSONLines writes one compact FileData object per line, which is
+// easy to stream, grep and split.
+func generateJSONLines(data []FileData) (string, error) {
+   var builder strings.Builder
+   for _, file := range data {
+      line, err := json.Marshal(file)
+      if err != nil {
+         return "", err
+      }
+      builder.Write(line)
+      builder.WriteByte('\n')
+   }
+   return builder.String(), nil
+}
+
+// generateMarkdown writes a heading with the path of each file, followed by
+// its content in a fenced block labelled with the language. A missing final
+// newline is added, so the closing fence is on a line of its own.
+func generateMarkdown(data []FileData) (string, error) {
+   var builder strings.Builder
+   for i, file := range data {
+      if i > 0 {
+         builder.WriteByte('\n')
+      }
+      fence := fenceFor(file.Data)
+      fmt.Fprintf(&builder, "## %s\n\n%s%s\n", file.Name, fence, languageFor(file.Name))
+      builder.WriteString(file.Data)
+      if !strings.HasSuffix(file.Data, "\n") {
+         builder.WriteByte('\n')
+      }
+      builder.WriteString(fence + "\n")
+   }
+   return builder.String(), nil
+}
+
+// fenceFor returns a backtick fence longer than any backtick run in the
+// content, so Markdown files that contain fences of their own stay intact.
+func fenceFor(content string) string {
+   longest, run := 0, 0
+   for _, r := range content {
+      if r == '`' {
+         run++
+         longest = max(longest, run)
+      } else {
+         run = 0
+      }
+   }
+   return strings.Repeat("`", max(3, longest+1))
+}
+
+// languageFor maps a file name to the info string of a Markdown fence.
+// Unknown extensions are left unlabelled.
+func languageFor(name string) string {
+   switch strings.ToLower(path.Base(name)) {
+   case "dockerfile":
+      return "dockerfile"
+   case "makefile":
+      return "makefile"
+   }
+   languages := map[string]string{
+      ".bat":   "bat",
+      ".c":     "c",
+      ".cpp":   "cpp",
+      ".cs":    "csharp",
+      ".css":   "css",
+      ".go":    "go",
+      ".h":     "c",
+      ".html":  "html",
+      ".java":  "java",
+      ".js":    "javascript",
+      ".json":  "json",
+      ".kt":    "kotlin",
+      ".md":    "markdown",
+      ".mod":   "go",
+      ".php":   "php",
+      ".ps1":   "powershell",
+      ".py":    "python",
+      ".rb":    "ruby",
+      ".rs":    "rust",
+      ".sh":    "sh",
+      ".sql":   "sql",
+      ".swift": "swift",
+      ".toml":  "toml",
+      ".ts":    "typescript",
+      ".tsx":   "tsx",
+      ".txt":   "text",
+      ".xml":   "xml",
+      ".yaml":  "yaml",
+      ".yml":   "yaml",
+   }
+   return languages[strings.ToLower(path.Ext(name))]
+}
+
+// generateXML wraps each file in a <file path="..."> element. The content is
+// written as is, not escaped, because that is what chat assistants read best;
+// only the closing tag on a line of its own ends a file.
+func generateXML(data []FileData) (string, error) {
+   var builder strings.Builder
+   builder.WriteString("<files>\n")
+   for _, file := range data {
+      fmt.Fprintf(&builder, "<file path=\"%s\">\n", html.EscapeString(file.Name))
+      builder.WriteString(file.Data)
+      if !strings.HasSuffix(file.Data, "\n") {
+         builder.WriteByte('\n')
+      }
+      builder.WriteString("</file>\n")
+   }
+   builder.WriteString("</files>\n")
+   return builder.String(), nil
+}
@@ -0,0 +1,137 @@
+// The .gitignore matching here is modelled on 2025/12/go-space/ignore.go, but
+// it is written for this module and maintained separately.
+
+package main
+
+import (
+   "bufio"
+   "errors"
+   "io/fs"
+   "os"
+   "path"
+   "path/filepath"
+   "slices"
+   "strings"
+)
+
+// ignoreRule is one line of a .gitignore file.
+type ignoreRule struct {
+   base     string
+   pattern  string
+   negate   bool
+   dirOnly  bool
+   anchored bool
+}
+
+// ignoreRules holds every rule in effect for a directory, parents first.
+type ignoreRules []ignoreRule
+
+// parentIgnoreRules collects the .gitignore files above dir, up to the top
+// of the repository, so bundling a subfolder follows the same rules as git.
+func parentIgnoreRules(dir string) (ignoreRules, error) {
+   dir, err := filepath.Abs(dir)
+   if err != nil {
+      return nil, err
+   }
+   var dirs []string
+   for {
+      if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+         break
+      }
+      up := filepath.Dir(dir)
+      if up == dir {
+         // Not inside a repository, so only the rules under -dir apply.
+         return nil, nil
+      }
+      dir = up
+      dirs = append(dirs, dir)
+   }
+   var rules ignoreRules
+   for _, parent := range slices.Backward(dirs) {
+      rules, err = rules.read(parent)
+      if err != nil {
+         return nil, err
+      }
+   }
+   return rules, nil
+}
+
+// read appends the rules of dir/.gitignore. They come last, so they win.
+func (r ignoreRules) read(dir string) (ignoreRules, error) {
+   file, err := os.Open(filepath.Join(dir, ".gitignore"))
+   if errors.Is(err, fs.ErrNotExist) {
+      return r, nil
+   }
+   if err != nil {
+      return nil, err
+   }
+   defer file.Close()
+
+   // Cap the capacity so sibling directories never share an append.
+   rules := r[:len(r):len(r)]
+   scanner := bufio.NewScanner(file)
+   for scanner.Scan() {
+      line := strings.TrimRight(scanner.Text(), " \r")
+      if line == "" || strings.HasPrefix(line, "#") {
+         continue
+      }
+      rule := ignoreRule{base: dir}
+      line, rule.negate = strings.CutPrefix(line, "!")
+      line = strings.TrimPrefix(line, `\`)
+      line, rule.dirOnly = strings.CutSuffix(line, "/")
+      // A slash at the start or in the middle ties the pattern to this directory.
+      rule.anchored = strings.Contains(line, "/")
+      rule.pattern = strings.TrimPrefix(line, "/")
+      rules = append(rules, rule)
+   }
+   return rules, scanner.Err()
+}
+
+// match reports whether the absolute path name is ignored. The last matching
+// rule decides, so "!" patterns can bring files back.
+func (r ignoreRules) match(name string, isDir bool) bool {
+   ignored := false
+   for _, rule := range r {
+      if rule.dirOnly && !isDir {
+         continue
+      }
+      rel, err := filepath.Rel(rule.base, name)
+      if err != nil || strings.HasPrefix(rel, "..") {
+         continue
+      }
+      rel = filepath.ToSlash(rel)
+      var ok bool
+      if rule.anchored {
+         ok = globMatch(strings.Split(rule.pattern, "/"), strings.Split(rel, "/"))
+      } else {
+         ok, _ = path.Match(rule.pattern, path.Base(rel))
+      }
+      if ok {
+         ignored = !rule.negate
+      }
+   }
+   return ignored
+}
+
+// globMatch is path.Match element by element, where "**" matches any number
+// of elements.
+func globMatch(pattern, name []string) bool {
+   for len(pattern) > 0 {
+      if pattern[0] == "**" {
+         for i := range len(name) + 1 {
+            if globMatch(pattern[1:], name[i:]) {
+               return true
+            }
+         }
+         return false
+      }
+      if len(name) == 0 {
+         return false
+      }
+      if ok, _ := path.Match(pattern[0], name[0]); !ok {
+         return false
+      }
+      pattern, name = pattern[1:], name[1:]
+   }
+   return len(name) == 0
+}
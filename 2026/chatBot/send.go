@@ -0,0 +1,223 @@
+package main
+
+import (
+   "bufio"
+   "bytes"
+   "encoding/json"
+   "errors"
+   "flag"
+   "fmt"
+   "io"
+   "log"
+   "mime"
+   "net/http"
+   "os"
+   "strings"
+   "time"
+)
+
+// chatMessage is one message of an OpenAI-compatible chat completion.
+type chatMessage struct {
+   Role    string `json:"role"`
+   Content string `json:"content"`
+}
+
+// chatRequest is the body posted to the chat-completions endpoint.
+type chatRequest struct {
+   Model    string        `json:"model,omitempty"`
+   Messages []chatMessage `json:"messages"`
+   Stream   bool          `json:"stream"`
+}
+
+// chatChunk covers both a streamed chunk, which has a delta, and a complete
+// response, which has a message, for servers that ignore "stream".
+type chatChunk struct {
+   Choices []struct {
+      Delta   chatMessage `json:"delta"`
+      Message chatMessage `json:"message"`
+   } `json:"choices"`
+   Error *struct {
+      Message string `json:"message"`
+   } `json:"error"`
+}
+
+// runSend is the "send" subcommand. It posts a bundle and a prompt to an
+// OpenAI-compatible chat-completions URL, such as a local llama.cpp or
+// Ollama server, prints the answer as it streams in, and appends the whole
+// exchange to a transcript file.
+func runSend(args []string) {
+   flags := flag.NewFlagSet("send", flag.ExitOnError)
+   url := flags.String("url", "http://localhost:8080/v1/chat/completions", "The chat-completions URL (Ollama uses http://localhost:11434/v1/chat/completions).")
+   model := flags.String("model", "", "The model name, if the server needs one.")
+   prompt := flags.String("p", "", "The prompt sent before the bundle (required).")
+   system := flags.String("system", "", "An optional system message.")
+   transcript := flags.String("transcript", "transcript.md", `The file the conversation is appended to, or "" for none.`)
+   timeout := flags.Duration("timeout", 10*time.Minute, "How long to wait for the whole answer.")
+   flags.Usage = func() {
+      fmt.Fprintln(flags.Output(), "Usage: chatBot send [flags] bundle")
+      fmt.Fprintln(flags.Output(), `The bundle can be "-" for stdin. OPENAI_API_KEY is sent as a bearer token when set.`)
+      flags.PrintDefaults()
+   }
+   flags.Parse(args)
+   if flags.NArg() != 1 || *prompt == "" {
+      flags.Usage()
+      os.Exit(1)
+   }
+
+   // 1. Read the bundle.
+   bundleName := flags.Arg(0)
+   var bundle []byte
+   var err error
+   if bundleName == "-" {
+      bundle, err = io.ReadAll(os.Stdin)
+   } else {
+      bundle, err = os.ReadFile(bundleName)
+   }
+   if err != nil {
+      log.Fatalf("Error reading bundle %s: %v", bundleName, err)
+   }
+
+   // 2. Build the conversation. The prompt goes first, so it is read before
+   // a long bundle.
+   var messages []chatMessage
+   if *system != "" {
+      messages = append(messages, chatMessage{Role: "system", Content: *system})
+   }
+   userMessage := *prompt + "\n\n" + string(bundle)
+   messages = append(messages, chatMessage{Role: "user", Content: userMessage})
+   log.Printf("Sending about %d tokens to %s", estimateTokens(userMessage), *url)
+
+   // 3. Stream the answer to stdout.
+   client := &http.Client{Timeout: *timeout}
+   answer, err := sendChat(client, *url, chatRequest{Model: *model, Messages: messages, Stream: true}, os.Stdout)
+   fmt.Println()
+   if err != nil {
+      // Keep whatever arrived before the error in the transcript.
+      log.Printf("Error: %v", err)
+   }
+
+   // 4. Append the exchange to the transcript.
+   if *transcript != "" {
+      messages = append(messages, chatMessage{Role: "assistant", Content: answer})
+      if terr := appendTranscript(*transcript, *url, *model, messages); terr != nil {
+         log.Fatalf("Error writing transcript %s: %v", *transcript, terr)
+      }
+      log.Printf("Conversation appended to %s", *transcript)
+   }
+   if err != nil {
+      os.Exit(1)
+   }
+}
+
+// sendChat posts the request and copies the answer to out as it arrives. It
+// returns the full answer, or as much of it as arrived before an error.
+func sendChat(client *http.Client, url string, request chatRequest, out io.Writer) (string, error) {
+   body, err := json.Marshal(request)
+   if err != nil {
+      return "", err
+   }
+   req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+   if err != nil {
+      return "", err
+   }
+   req.Header.Set("Content-Type", "application/json")
+   req.Header.Set("Accept", "text/event-stream")
+   if key := os.Getenv("OPENAI_API_KEY"); key != "" {
+      req.Header.Set("Authorization", "Bearer "+key)
+   }
+
+   resp, err := client.Do(req)
+   if err != nil {
+      return "", err
+   }
+   defer resp.Body.Close()
+   if resp.StatusCode != http.StatusOK {
+      message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+      return "", fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(message)))
+   }
+
+   var answer strings.Builder
+   write := func(text string) {
+      answer.WriteString(text)
+      io.WriteString(out, text)
+   }
+
+   // A server that does not stream sends one JSON response instead.
+   mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+   if mediaType == "application/json" {
+      var chunk chatChunk
+      if err := json.NewDecoder(resp.Body).Decode(&chunk); err != nil {
+         return "", err
+      }
+      if err := chunk.err(); err != nil {
+         return "", err
+      }
+      for _, choice := range chunk.Choices {
+         write(choice.Message.Content)
+      }
+      return answer.String(), nil
+   }
+
+   // Server-sent events: each "data:" line holds a chunk, until "[DONE]".
+   scanner := bufio.NewScanner(resp.Body)
+   scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+   for scanner.Scan() {
+      data, ok := strings.CutPrefix(scanner.Text(), "data:")
+      if !ok {
+         continue
+      }
+      data = strings.TrimSpace(data)
+      if data == "[DONE]" {
+         return answer.String(), nil
+      }
+      var chunk chatChunk
+      if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+         return answer.String(), fmt.Errorf("bad chunk %q: %v", data, err)
+      }
+      if err := chunk.err(); err != nil {
+         return answer.String(), err
+      }
+      for _, choice := range chunk.Choices {
+         write(choice.Delta.Content)
+      }
+   }
+   if err := scanner.Err(); err != nil {
+      return answer.String(), err
+   }
+   // Some servers just close the stream instead of sending [DONE].
+   return answer.String(), nil
+}
+
+// err turns an error object in a response into a Go error.
+func (c chatChunk) err() error {
+   if c.Error != nil {
+      return errors.New(c.Error.Message)
+   }
+   return nil
+}
+
+// appendTranscript adds the conversation to a Markdown file, one section per
+// message, so the file reads well and can be bundled again later.
+func appendTranscript(name, url, model string, messages []chatMessage) error {
+   file, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+   if err != nil {
+      return err
+   }
+   var builder strings.Builder
+   fmt.Fprintf(&builder, "# %s\n\n", time.Now().Format(time.DateTime))
+   fmt.Fprintf(&builder, "- url: %s\n", url)
+   if model != "" {
+      fmt.Fprintf(&builder, "- model: %s\n", model)
+   }
+   for _, message := range messages {
+      fmt.Fprintf(&builder, "\n## %s\n\n", message.Role)
+      builder.WriteString(strings.TrimRight(message.Content, "\n"))
+      builder.WriteString("\n")
+   }
+   builder.WriteString("\n")
+   _, err = file.WriteString(builder.String())
+   if cerr := file.Close(); err == nil {
+      err = cerr
+   }
+   return err
+}
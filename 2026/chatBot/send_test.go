@@ -0,0 +1,121 @@
+package main
+
+import (
+   "encoding/json"
+   "fmt"
+   "net/http"
+   "net/http/httptest"
+   "strings"
+   "testing"
+)
+
+// stubServer answers chat completions with a fixed response and records the
+// request it received.
+func stubServer(t *testing.T, contentType string, status int, body string, got *chatRequest) *httptest.Server {
+   t.Helper()
+   server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+      if got != nil {
+         if err := json.NewDecoder(r.Body).Decode(got); err != nil {
+            t.Errorf("decoding request: %v", err)
+         }
+         if auth := r.Header.Get("Authorization"); auth != "Bearer test-key" {
+            t.Errorf("Authorization = %q", auth)
+         }
+      }
+      w.Header().Set("Content-Type", contentType)
+      w.WriteHeader(status)
+      fmt.Fprint(w, body)
+   }))
+   t.Cleanup(server.Close)
+   return server
+}
+
+func TestSendChat(t *testing.T) {
+   tests := []struct {
+      name        string
+      contentType string
+      status      int
+      body        string
+      wantAnswer  string
+      wantErr     string
+   }{
+      {
+         name:        "stream",
+         contentType: "text/event-stream",
+         status:      http.StatusOK,
+         body: "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\"}}]}\n\n" +
+            ": keep-alive\n\n" +
+            "data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\n" +
+            "data: {\"choices\":[{\"delta\":{\"content\":\", world\"}}]}\n\n" +
+            "data: [DONE]\n\n",
+         wantAnswer: "Hello, world",
+      },
+      {
+         name:        "stream closed without done",
+         contentType: "text/event-stream",
+         status:      http.StatusOK,
+         body:        "data: {\"choices\":[{\"delta\":{\"content\":\"partial\"}}]}\n\n",
+         wantAnswer:  "partial",
+      },
+      {
+         name:        "not streamed",
+         contentType: "application/json; charset=utf-8",
+         status:      http.StatusOK,
+         body:        `{"choices":[{"message":{"role":"assistant","content":"whole answer"}}]}`,
+         wantAnswer:  "whole answer",
+      },
+      {
+         name:        "error object in the stream",
+         contentType: "text/event-stream",
+         status:      http.StatusOK,
+         body: "data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\n" +
+            "data: {\"error\":{\"message\":\"context length exceeded\"}}\n\n",
+         wantAnswer: "Hel",
+         wantErr:    "context length exceeded",
+      },
+      {
+         name:        "error object in JSON",
+         contentType: "application/json",
+         status:      http.StatusOK,
+         body:        `{"error":{"message":"model not loaded"}}`,
+         wantErr:     "model not loaded",
+      },
+      {
+         name:        "status not OK",
+         contentType: "application/json",
+         status:      http.StatusNotFound,
+         body:        `{"error":{"message":"model not found"}}`,
+         wantErr:     "404 Not Found",
+      },
+   }
+   for _, test := range tests {
+      t.Run(test.name, func(t *testing.T) {
+         t.Setenv("OPENAI_API_KEY", "test-key")
+         var got chatRequest
+         server := stubServer(t, test.contentType, test.status, test.body, &got)
+         request := chatRequest{
+            Model:    "local",
+            Messages: []chatMessage{{Role: "user", Content: "hi"}},
+            Stream:   true,
+         }
+         var out strings.Builder
+         answer, err := sendChat(server.Client(), server.URL, request, &out)
+
+         if test.wantErr == "" && err != nil {
+            t.Fatalf("unexpected error: %v", err)
+         }
+         if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+            t.Fatalf("error = %v, want one containing %q", err, test.wantErr)
+         }
+         if answer != test.wantAnswer {
+            t.Errorf("answer = %q, want %q", answer, test.wantAnswer)
+         }
+         if out.String() != test.wantAnswer {
+            t.Errorf("printed %q, want %q", out.String(), test.wantAnswer)
+         }
+         if got.Model != "local" || !got.Stream || len(got.Messages) != 1 || got.Messages[0].Content != "hi" {
+            t.Errorf("server got %+v", got)
+         }
+      })
+   }
+}
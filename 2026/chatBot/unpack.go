@@ -0,0 +1,316 @@
+package main
+
+import (
+   "bufio"
+   "encoding/json"
+   "errors"
+   "flag"
+   "fmt"
+   "html"
+   "io"
+   "io/fs"
+   "log"
+   "os"
+   "path"
+   "path/filepath"
+   "regexp"
+   "strings"
+)
+
+// runUnpack is the "unpack" subcommand. It reads a bundle, in any of the
+// formats chatBot writes or as Markdown fenced blocks with file names, and
+// writes the files back under -dir. Paths that would leave -dir are refused,
+// and changed files are shown as a diff and only overwritten after a yes.
+func runUnpack(args []string) {
+   flags := flag.NewFlagSet("unpack", flag.ExitOnError)
+   targetDir := flags.String("dir", ".", "The directory to write the files under.")
+   assumeYes := flags.Bool("y", false, "Overwrite changed files without asking.")
+   flags.Usage = func() {
+      fmt.Fprintln(flags.Output(), "Usage: chatBot unpack [flags] bundle")
+      fmt.Fprintln(flags.Output(), `The bundle can be "-" for stdin.`)
+      flags.PrintDefaults()
+   }
+   flags.Parse(args)
+   if flags.NArg() != 1 {
+      flags.Usage()
+      os.Exit(1)
+   }
+
+   // 1. Read the bundle, and find somewhere to read the answers from.
+   bundleName := flags.Arg(0)
+   var content []byte
+   var err error
+   answers := os.Stdin
+   if bundleName == "-" {
+      content, err = io.ReadAll(os.Stdin)
+      if !*assumeYes {
+         // Stdin is taken by the bundle, so ask on the terminal instead.
+         answers, err = os.Open("/dev/tty")
+         if err != nil {
+            log.Fatalf("Error: Cannot ask for confirmation (%v); use -y when the bundle comes from stdin.", err)
+         }
+         defer answers.Close()
+      }
+   } else {
+      content, err = os.ReadFile(bundleName)
+   }
+   if err != nil {
+      log.Fatalf("Error reading bundle %s: %v", bundleName, err)
+   }
+
+   // 2. Parse it.
+   files, err := parseBundle(string(content))
+   if err != nil {
+      log.Fatalf("Error parsing bundle %s: %v", bundleName, err)
+   }
+   if len(files) == 0 {
+      log.Printf("Warning: No files were found in %s.", bundleName)
+      return
+   }
+
+   // 3. Open the target as an os.Root, so nothing can be written outside it,
+   // symbolic links included.
+   err = os.MkdirAll(*targetDir, 0755)
+   if err != nil {
+      log.Fatalf("Error creating %s: %v", *targetDir, err)
+   }
+   root, err := os.OpenRoot(*targetDir)
+   if err != nil {
+      log.Fatalf("Error opening %s: %v", *targetDir, err)
+   }
+   defer root.Close()
+
+   // 4. Write each file, asking first when it would change an existing one.
+   reader := bufio.NewReader(answers)
+   counts := make(map[string]int)
+   for _, file := range files {
+      result, err := unpackFile(root, file, reader, *assumeYes)
+      if err != nil {
+         log.Printf("Error: %s: %v", file.Name, err)
+         result = "failed"
+      }
+      counts[result]++
+   }
+   log.Printf("Done: %d created, %d updated, %d unchanged, %d skipped, %d failed.",
+      counts["created"], counts["updated"], counts["unchanged"], counts["skipped"], counts["failed"])
+   if counts["failed"] > 0 {
+      os.Exit(1)
+   }
+}
+
+// unpackFile writes one file under root and says what happened to it.
+func unpackFile(root *os.Root, file FileData, answers *bufio.Reader, assumeYes bool) (string, error) {
+   name := filepath.FromSlash(file.Name)
+   if !filepath.IsLocal(name) {
+      return "", errors.New("refusing a path outside the target directory")
+   }
+
+   perm := fs.FileMode(0644)
+   existing, err := root.ReadFile(name)
+   created := errors.Is(err, fs.ErrNotExist)
+   switch {
+   case created:
+      log.Printf("New file %s (%d lines)", file.Name, len(splitLines(file.Data)))
+   case err != nil:
+      return "", err
+   case string(existing) == file.Data:
+      log.Printf("Unchanged %s", file.Name)
+      return "unchanged", nil
+   default:
+      // Keep the mode of the file being replaced, such as an executable bit.
+      if info, err := root.Stat(name); err == nil {
+         perm = info.Mode().Perm()
+      }
+      fmt.Fprint(os.Stderr, unifiedDiff(file.Name, string(existing), file.Data))
+      if !assumeYes && !confirm(answers, fmt.Sprintf("Overwrite %s?", file.Name)) {
+         log.Printf("Skipped %s", file.Name)
+         return "skipped", nil
+      }
+   }
+
+   err = root.MkdirAll(filepath.Dir(name), 0755)
+   if err != nil {
+      return "", err
+   }
+   err = root.WriteFile(name, []byte(file.Data), perm)
+   if err != nil {
+      return "", err
+   }
+   if created {
+      return "created", nil
+   }
+   return "updated", nil
+}
+
+// confirm asks a yes or no question on stderr. Anything but y or yes is no.
+func confirm(answers *bufio.Reader, question string) bool {
+   fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+   answer, _ := answers.ReadString('\n')
+   answer = strings.ToLower(strings.TrimSpace(answer))
+   return answer == "y" || answer == "yes"
+}
+
+// parseBundle recognises a JSON array, JSON lines, XML-style <file> blocks or
+// Markdown, in that order.
+func parseBundle(content string) ([]FileData, error) {
+   trimmed := strings.TrimSpace(content)
+   switch {
+   case strings.HasPrefix(trimmed, "["):
+      var files []FileData
+      err := json.Unmarshal([]byte(trimmed), &files)
+      return files, err
+   case strings.HasPrefix(trimmed, "{"):
+      var files []FileData
+      decoder := json.NewDecoder(strings.NewReader(trimmed))
+      for decoder.More() {
+         var file FileData
+         if err := decoder.Decode(&file); err != nil {
+            return nil, err
+         }
+         files = append(files, file)
+      }
+      return files, nil
+   case xmlFilePattern.MatchString(content):
+      return parseXMLBundle(content), nil
+   }
+   return parseMarkdownBundle(content), nil
+}
+
+// xmlFilePattern matches the opening line that generateXML writes.
+var xmlFilePattern = regexp.MustCompile(`(?m)^\s*<file path="([^"]*)">\s*$`)
+
+// parseXMLBundle reads the <file path="..."> blocks of generateXML. As the
+// content is not escaped, a file ends at the first "</file>" line. Anything
+// between the blocks, such as an assistant's explanation, is ignored.
+func parseXMLBundle(content string) []FileData {
+   var files []FileData
+   var current *FileData
+   var data strings.Builder
+   for _, line := range strings.SplitAfter(content, "\n") {
+      trimmed := strings.TrimRight(line, "\r\n")
+      if current == nil {
+         if match := xmlFilePattern.FindStringSubmatch(trimmed); match != nil {
+            current = &FileData{Name: html.UnescapeString(match[1])}
+            data.Reset()
+         }
+         continue
+      }
+      if strings.TrimSpace(trimmed) == "</file>" {
+         current.Data = data.String()
+         files = append(files, *current)
+         current = nil
+         continue
+      }
+      data.WriteString(line)
+   }
+   if current != nil {
+      log.Printf("Warning: %s has no closing </file> and was skipped.", current.Name)
+   }
+   return files
+}
+
+// parseMarkdownBundle reads fenced blocks. A block's file name comes from
+// its info string ("go:main.go", "go title=main.go" or just "main.go") or,
+// failing that, from the line before it, such as a "## main.go" heading.
+// Blocks without a name are skipped.
+func parseMarkdownBundle(content string) []FileData {
+   var files []FileData
+   candidate := ""
+   lines := strings.SplitAfter(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+   for i := 0; i < len(lines); i++ {
+      trimmed := strings.TrimSpace(lines[i])
+      fence := openingFence(trimmed)
+      if fence == "" {
+         if trimmed != "" {
+            candidate = fileNameFromLine(trimmed)
+         }
+         continue
+      }
+
+      name := fileNameFromInfo(strings.TrimSpace(trimmed[len(fence):]))
+      if name == "" {
+         name = candidate
+      }
+      candidate = ""
+
+      // The block ends at a fence of the same character that is at least
+      // as long, or at the end of the input.
+      var data strings.Builder
+      for i++; i < len(lines); i++ {
+         closing := strings.TrimSpace(lines[i])
+         if strings.HasPrefix(closing, fence) && strings.Trim(closing, fence[:1]) == "" {
+            break
+         }
+         data.WriteString(lines[i])
+      }
+      if name == "" {
+         log.Printf("Skipping a fenced block with no file name.")
+         continue
+      }
+      files = append(files, FileData{Name: name, Data: data.String()})
+   }
+   return files
+}
+
+// openingFence returns the run of three or more backticks or tildes that
+// opens a fenced block, or "" if the line is not one.
+func openingFence(line string) string {
+   for _, mark := range []string{"`", "~"} {
+      run := len(line) - len(strings.TrimLeft(line, mark))
+      if run >= 3 {
+         // A backtick fence cannot have backticks in its info string.
+         if mark == "`" && strings.Contains(line[run:], "`") {
+            return ""
+         }
+         return line[:run]
+      }
+   }
+   return ""
+}
+
+// fileNameFromLine finds a path in a line such as "## src/main.go",
+// "**`main.go`**:" or "File: main.go". It returns "" for ordinary prose.
+func fileNameFromLine(line string) string {
+   // A "## " heading is what generateMarkdown writes, so all of it is the
+   // path, including names without a dot such as Makefile or LICENSE.
+   if heading, ok := strings.CutPrefix(line, "## "); ok {
+      return strings.TrimSpace(heading)
+   }
+   line = strings.TrimLeft(line, "#>-* ")
+   line = strings.TrimRight(line, ": ")
+   for _, prefix := range []string{"File:", "file:", "Filename:", "filename:"} {
+      line = strings.TrimSpace(strings.TrimPrefix(line, prefix))
+   }
+   line = strings.Trim(line, "*_`\"' ")
+   if looksLikePath(line) {
+      return line
+   }
+   return ""
+}
+
+// fileNameFromInfo finds a path in the info string of a fence.
+func fileNameFromInfo(info string) string {
+   for _, field := range strings.Fields(info) {
+      for _, key := range []string{"title=", "file=", "filename=", "path="} {
+         field = strings.TrimPrefix(field, key)
+      }
+      field = strings.Trim(field, `"'`)
+      // "go:main.go" is a language and a path.
+      if _, after, ok := strings.Cut(field, ":"); ok {
+         field = after
+      }
+      if looksLikePath(field) {
+         return field
+      }
+   }
+   return ""
+}
+
+// looksLikePath accepts a single word with a dot or a slash in it, which is
+// all file names in a bundle are expected to have.
+func looksLikePath(text string) bool {
+   if text == "" || strings.ContainsAny(text, " \t") {
+      return false
+   }
+   return strings.ContainsAny(text, "./") && path.Clean(text) != "."
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+   "reflect"
+   "testing"
+)
+
+func TestParseMarkdownBundle(t *testing.T) {
+   files := []FileData{
+      {Name: "main.go", Data: "package main\n"},
+      {Name: "Makefile", Data: "all:\n\tgo build\n"},
+      {Name: "LICENSE", Data: "MIT"},
+      {Name: "docker/Dockerfile", Data: "FROM scratch\n"},
+   }
+   bundle, err := generateMarkdown(files)
+   if err != nil {
+      t.Fatal(err)
+   }
+   got := parseMarkdownBundle(bundle)
+   // generateMarkdown adds the missing final newline.
+   files[2].Data += "\n"
+   if !reflect.DeepEqual(got, files) {
+      t.Errorf("got %+v, want %+v", got, files)
+   }
+}
+
+func TestFileNameFromLine(t *testing.T) {
+   tests := []struct {
+      line string
+      want string
+   }{
+      {"## Makefile", "Makefile"},
+      {"## src/main.go", "src/main.go"},
+      {"**`main.go`**:", "main.go"},
+      {"File: cmd/tool.go", "cmd/tool.go"},
+      {"Here is the Makefile:", ""},
+      {"Run it like this.", ""},
+   }
+   for _, test := range tests {
+      if got := fileNameFromLine(test.line); got != test.want {
+         t.Errorf("fileNameFromLine(%q) = %q, want %q", test.line, got, test.want)
+      }
+   }
+}